@@ -20,6 +20,12 @@ func BindFormData(dest interface{}, formData url.Values) error {
 	return bindData(dest, formData, "form")
 }
 
+// BindPathParams will unmarshal path params into a struct or map, pointed by dest.
+// Struct fields are matched using the path tag.
+func BindPathParams(dest interface{}, params url.Values) error {
+	return bindData(dest, params, "path")
+}
+
 func bindData(ptr interface{}, data map[string][]string, tag string) error {
 	if ptr == nil || len(data) == 0 {
 		return nil
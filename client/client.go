@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -47,12 +48,21 @@ func RequestTimeout(timeout time.Duration) Option {
 	}
 }
 
+// Context sets the context of the request. The request ID it carries, if
+// any, is forwarded in the X-Request-ID header unless the header is set.
+func Context(ctx context.Context) Option {
+	return func(options *clientOptions) {
+		options.Context = ctx
+	}
+}
+
 type clientOptions struct {
 	RetryCount     int
 	RetryWaitTime  time.Duration
 	KeepAlive      bool
 	DialTimeout    *time.Duration
 	RequestTimeout *time.Duration
+	Context        context.Context
 }
 
 var defaultClientOption = clientOptions{
@@ -207,12 +217,21 @@ func (c *httpClient) Call(options ...Option) (*http.Response, error) {
 		c.headers.Set("Content-Type", gohttp.HttpContentTypeUrlFormEncoded)
 	}
 
-	req, err := http.NewRequest(c.method, c.url, body)
+	ctx := clopts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.method, c.url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to form http request: %s", err)
 	}
 
 	req.Header = c.headers
+	if reqid, ok := gohttp.RequestIDFromContext(ctx); ok && req.Header.Get(gohttp.HeaderXRequestID) == "" {
+		req.Header = req.Header.Clone()
+		req.Header.Set(gohttp.HeaderXRequestID, reqid)
+	}
 	req.Close = !clopts.KeepAlive
 
 	var res *http.Response
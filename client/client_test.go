@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/tj/assert"
+)
+
+func TestRequestIDForwarding(t *testing.T) {
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(gohttp.HeaderXRequestID)
+	}))
+	defer srv.Close()
+
+	ctx := gohttp.ContextWithRequestID(context.Background(), "req-1")
+	cl := New().URL(srv.URL)
+
+	res, err := cl.Call(Context(ctx))
+	assert.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, "req-1", received)
+
+	res, err = cl.Set(gohttp.HeaderXRequestID, "explicit").Call(Context(ctx))
+	assert.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, "explicit", received)
+
+	res, err = cl.Call()
+	assert.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, "", received)
+}
@@ -3,6 +3,8 @@ package go_kit_util
 import (
 	"context"
 	"net/http"
+
+	gohttp "github.com/likearthian/go-http"
 )
 
 type contextKey int
@@ -119,7 +121,13 @@ func PopulateRequestContextFromHttp(ctx context.Context, r *http.Request) contex
 	return ctx
 }
 
+// ReqIDFromContext returns the request ID set by the request ID middleware,
+// or else the X-Request-Id header populated by PopulateRequestContext.
 func ReqIDFromContext(ctx context.Context) (string, bool) {
+	if reqID, ok := gohttp.RequestIDFromContext(ctx); ok {
+		return reqID, true
+	}
+
 	reqID, ok := ctx.Value(ContextKeyRequestXRequestID).(string)
 	if !ok {
 		return "", false
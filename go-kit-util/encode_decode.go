@@ -1,18 +1,14 @@
 package go_kit_util
 
 import (
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"reflect"
-	"strings"
 
 	httptransport "github.com/go-kit/kit/transport/http"
 	gohttp "github.com/likearthian/go-http"
-	"github.com/likearthian/go-http/router"
 )
 
 type requestDecoderOption struct {
@@ -109,17 +105,12 @@ func MakeCommonPostRequestDecoder(output reflect.Type, options ...RequestDecoder
 	}
 }
 
+// CommonJSONResponseEncoder encodes response as JSON. Responses are
+// compressed by the compression middleware of the router, see
+// middleware.MakeHttpCompressionMiddleware.
 func CommonJSONResponseEncoder(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
-	var gw io.Writer = w
-	if needGzipped(ctx) {
-		w.Header().Set("Content-Encoding", "gzip")
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
-		gw = gz
-	}
-
-	return json.NewEncoder(gw).Encode(response)
+	return json.NewEncoder(w).Encode(response)
 }
 
 func CommonByteResponseEncoder(ctx context.Context, w http.ResponseWriter, response interface{}) error {
@@ -128,16 +119,7 @@ func CommonByteResponseEncoder(ctx context.Context, w http.ResponseWriter, respo
 		return fmt.Errorf("response format for commonByteResponseEncoder is not []byte")
 	}
 
-	var gw io.Writer = w
-
-	if needGzipped(ctx) {
-		w.Header().Set("Content-Encoding", "gzip")
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
-		gw = gz
-	}
-
-	_, err := gw.Write(buf)
+	_, err := w.Write(buf)
 	return err
 }
 
@@ -149,36 +131,11 @@ func MakeCommonByteResponseEncoder(contentType string) httptransport.EncodeRespo
 			return fmt.Errorf("response format for commonByteResponseEncoder is not []byte")
 		}
 
-		var gw io.Writer = w
-
-		if needGzipped(ctx) {
-			w.Header().Set("Content-Encoding", "gzip")
-			gz := gzip.NewWriter(w)
-			defer gz.Close()
-			gw = gz
-		}
-
-		_, err := gw.Write(buf)
+		_, err := w.Write(buf)
 		return err
 	}
 }
 
-func needGzipped(ctx context.Context) bool {
-	val := ctx.Value(router.ContextKeyRequestAcceptEncoding)
-	enc, ok := val.(string)
-	var gzipped = false
-	if ok {
-		encodings := strings.Split(strings.ToLower(enc), ",")
-		for _, e := range encodings {
-			if strings.TrimSpace(e) == "gzip" {
-				gzipped = true
-			}
-		}
-	}
-
-	return gzipped
-}
-
 func WithAcceptedQueryFields(acceptedFields []string) RequestDecoderOption {
 	return func(d *requestDecoderOption) {
 		if len(acceptedFields) == 0 {
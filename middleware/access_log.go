@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+// AccessLogFormat is the line format of an access log.
+type AccessLogFormat int
+
+const (
+	// AccessLogCommon is the Common Log Format of the Apache HTTP server.
+	AccessLogCommon AccessLogFormat = iota
+	// AccessLogCombined is the Common Log Format followed by the referer and
+	// user agent.
+	AccessLogCombined
+	// AccessLogJSON writes a JSON object per line, including the route
+	// pattern, the latency and the time to first byte.
+	AccessLogJSON
+)
+
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogEntry describes a served request.
+type AccessLogEntry struct {
+	Time       time.Time     `json:"time"`
+	RemoteAddr string        `json:"remote_addr"`
+	User       string        `json:"user,omitempty"`
+	Method     string        `json:"method"`
+	URI        string        `json:"uri"`
+	Route      string        `json:"route,omitempty"`
+	Proto      string        `json:"proto"`
+	Status     int           `json:"status"`
+	Bytes      int64         `json:"bytes"`
+	Latency    time.Duration `json:"-"`
+	TTFB       time.Duration `json:"-"`
+	Referer    string        `json:"referer,omitempty"`
+	UserAgent  string        `json:"user_agent,omitempty"`
+	RequestID  string        `json:"request_id,omitempty"`
+}
+
+// MakeHttpAccessLogMiddleware returns a middleware writing a line to out for
+// every request, once it is served, in the given format. The route pattern is
+// the one recorded by the router wrapped, or by the router the middleware is
+// used in.
+func MakeHttpAccessLogMiddleware(out io.Writer, format AccessLogFormat) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry := serveLogged(next, w, r)
+
+			line := formatAccessLog(entry, format)
+			mu.Lock()
+			_, _ = io.WriteString(out, line)
+			mu.Unlock()
+		})
+	}
+}
+
+// serveLogged serves r with next and describes the response.
+func serveLogged(next http.Handler, w http.ResponseWriter, r *http.Request) AccessLogEntry {
+	start := time.Now()
+	ctx := gohttp.WithRoutePatternRecorder(r.Context())
+	r = r.WithContext(ctx)
+
+	rw := WrapResponseWriter(w)
+	next.ServeHTTP(rw, r)
+
+	status := rw.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	reqid, ok := gohttp.RequestIDFromContext(ctx)
+	if !ok {
+		reqid = r.Header.Get(gohttp.HeaderXRequestID)
+	}
+
+	user := "-"
+	if name, _, ok := r.BasicAuth(); ok && name != "" {
+		user = name
+	}
+
+	return AccessLogEntry{
+		Time:       start,
+		RemoteAddr: remoteHost(r),
+		User:       user,
+		Method:     r.Method,
+		URI:        r.RequestURI,
+		Route:      gohttp.RecordedRoutePattern(ctx),
+		Proto:      r.Proto,
+		Status:     status,
+		Bytes:      rw.BytesWritten(),
+		Latency:    time.Since(start),
+		TTFB:       rw.TimeToFirstByte(),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		RequestID:  reqid,
+	}
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func formatAccessLog(e AccessLogEntry, format AccessLogFormat) string {
+	if format == AccessLogJSON {
+		if e.User == "-" {
+			e.User = ""
+		}
+		b, _ := json.Marshal(struct {
+			AccessLogEntry
+			LatencyMs float64 `json:"latency_ms"`
+			TTFBMs    float64 `json:"ttfb_ms"`
+		}{e, durationMs(e.Latency), durationMs(e.TTFB)})
+		return string(b) + "\n"
+	}
+
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.FormatInt(e.Bytes, 10)
+	}
+
+	var b strings.Builder
+	b.WriteString(e.RemoteAddr + " - " + e.User + " [" + e.Time.Format(clfTimeFormat) + "] ")
+	b.WriteString(`"` + clfEscape(e.Method+" "+e.URI+" "+e.Proto) + `" `)
+	b.WriteString(strconv.Itoa(e.Status) + " " + bytes)
+	if format == AccessLogCombined {
+		b.WriteString(` "` + clfValue(e.Referer) + `" "` + clfValue(e.UserAgent) + `"`)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func clfValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return clfEscape(s)
+}
+
+var clfEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`, "\r", `\r`)
+
+func clfEscape(s string) string {
+	return clfEscaper.Replace(s)
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	route "github.com/likearthian/go-http/router/v2"
+	"github.com/tj/assert"
+)
+
+func newAccessLogMux() *route.Mux {
+	mx := route.NewRouter()
+	mx.Methods(http.MethodGet).Handler("/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	mx.Methods(http.MethodPost).Handler("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	return mx
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	serve := func(format AccessLogFormat, method, target string) string {
+		var out bytes.Buffer
+		h := MakeHttpAccessLogMiddleware(&out, format)(newAccessLogMux())
+
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		req.Header.Set("User-Agent", `curl/8.0 "test"`)
+		req.SetBasicAuth("ann", "secret")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		return out.String()
+	}
+
+	line := serve(AccessLogCommon, http.MethodGet, "/users/7?x=1")
+	assert.Regexp(t, regexp.MustCompile(`^10\.0\.0\.1 - ann \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /users/7\?x=1 HTTP/1\.1" 200 5\n$`), line)
+
+	line = serve(AccessLogCombined, http.MethodPost, "/users")
+	assert.Regexp(t, regexp.MustCompile(`"POST /users HTTP/1\.1" 201 - "-" "curl/8\.0 \\"test\\""\n$`), line)
+
+	line = serve(AccessLogJSON, http.MethodGet, "/users/7")
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+	assert.Equal(t, "/users/{id}", entry["route"])
+	assert.Equal(t, "/users/7", entry["uri"])
+	assert.Equal(t, "ann", entry["user"])
+	assert.Equal(t, float64(200), entry["status"])
+	assert.Equal(t, float64(5), entry["bytes"])
+	assert.Contains(t, entry, "latency_ms")
+	assert.Contains(t, entry, "ttfb_ms")
+
+	line = serve(AccessLogJSON, http.MethodGet, "/unknown")
+	entry = nil
+	assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+	assert.NotContains(t, entry, "route")
+	assert.Equal(t, float64(404), entry["status"])
+}
+
+func TestAccessLogRequestID(t *testing.T) {
+	var out bytes.Buffer
+	h := MakeHttpRequestIDMiddleware(RequestIDHeader("X-Trace-ID"))(MakeHttpAccessLogMiddleware(&out, AccessLogJSON)(newAccessLogMux()))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+	req.Header.Set("X-Trace-ID", "trace-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "trace-1", entry["request_id"])
+}
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestWrapResponseWriter(t *testing.T) {
+	rw := WrapResponseWriter(httptest.NewRecorder())
+	_, isFlusher := rw.(http.Flusher)
+	_, isHijacker := rw.(http.Hijacker)
+	_, isPusher := rw.(http.Pusher)
+	assert.True(t, isFlusher)
+	assert.False(t, isHijacker)
+	assert.False(t, isPusher)
+
+	assert.Equal(t, 0, rw.Status())
+	rw.(http.Flusher).Flush()
+	assert.Equal(t, http.StatusOK, rw.Status())
+	_, _ = rw.Write([]byte("abc"))
+	rw.WriteHeader(http.StatusTeapot)
+	assert.Equal(t, http.StatusOK, rw.Status())
+	assert.Equal(t, int64(3), rw.BytesWritten())
+
+	rw = WrapResponseWriter(hijackableRecorder{httptest.NewRecorder()})
+	_, isHijacker = rw.(http.Hijacker)
+	assert.True(t, isHijacker)
+	_, _, _ = rw.(http.Hijacker).Hijack()
+	assert.Equal(t, http.StatusSwitchingProtocols, rw.Status())
+}
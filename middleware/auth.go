@@ -0,0 +1,269 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request
+	// carries none of the credentials it handles.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned by an Authenticator when the
+	// credentials of the request are wrong.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is the authenticated client of a request.
+type Principal struct {
+	// Subject identifies the client: a user name, the owner of an API key or
+	// the sub claim of a token.
+	Subject string
+	// Scheme is the authentication scheme used, e.g. Basic or Bearer.
+	Scheme string
+	// Claims holds the claims of a token, or the attributes returned by an
+	// API key lookup.
+	Claims map[string]interface{}
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal authenticated by the
+// authentication middleware.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// ContextWithPrincipal returns a copy of ctx carrying p.
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Authenticator authenticates requests with one scheme.
+type Authenticator interface {
+	// Authenticate returns the principal of r. It returns ErrNoCredentials
+	// when r has no credentials for the scheme, and an error wrapping
+	// ErrInvalidCredentials when they are invalid.
+	Authenticate(r *http.Request) (*Principal, error)
+	// Challenge returns the WWW-Authenticate challenge answering a request
+	// failing with err.
+	Challenge(err error) string
+}
+
+// MakeHttpAuthenticationMiddleware returns a middleware authenticating the
+// requests with the first of authenticators finding credentials in them,
+// and putting the principal in the context. Requests with invalid
+// credentials get a 401 with the challenge of that authenticator, and
+// requests without credentials a 401 with the challenges of all of them.
+// Other errors of the authenticators, e.g. an unavailable key store, are
+// answered with a 500.
+func MakeHttpAuthenticationMiddleware(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range authenticators {
+				p, err := a.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if errors.Is(err, ErrInvalidCredentials) {
+					unauthorized(w, err.Error(), a.Challenge(err))
+					return
+				}
+				if err != nil {
+					writeJSONError(w, http.StatusInternalServerError, "authentication failed")
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), p)))
+				return
+			}
+
+			challenges := make([]string, 0, len(authenticators))
+			for _, a := range authenticators {
+				challenges = append(challenges, a.Challenge(ErrNoCredentials))
+			}
+			unauthorized(w, "authentication required", challenges...)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, message string, challenges ...string) {
+	for _, c := range challenges {
+		if c != "" {
+			w.Header().Add(gohttp.HeaderWWWAuthenticate, c)
+		}
+	}
+	writeJSONError(w, http.StatusUnauthorized, message)
+}
+
+// quoteAuthParam quotes the value of a challenge parameter.
+func quoteAuthParam(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// secureCompare compares a and b in a time independent of their content and
+// length.
+func secureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// BasicVerifier reports whether a user name and password are valid.
+type BasicVerifier func(username, password string) bool
+
+// BasicUsers verifies the credentials against users, mapping user names to
+// passwords, in a time independent of the credentials.
+func BasicUsers(users map[string]string) BasicVerifier {
+	return func(username, password string) bool {
+		ok := 0
+		for u, p := range users {
+			if secureCompare(u, username) && secureCompare(p, password) {
+				ok = 1
+			}
+		}
+		return ok == 1
+	}
+}
+
+type basicAuthenticator struct {
+	realm  string
+	verify BasicVerifier
+}
+
+// NewBasicAuthenticator authenticates the requests with HTTP Basic
+// authentication, the credentials being checked by verify.
+func NewBasicAuthenticator(realm string, verify BasicVerifier) Authenticator {
+	return &basicAuthenticator{realm: realm, verify: verify}
+}
+
+func (a *basicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if !hasAuthScheme(r, "Basic") {
+		return nil, ErrNoCredentials
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok || !a.verify(username, password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Subject: username, Scheme: "Basic"}, nil
+}
+
+func (a *basicAuthenticator) Challenge(err error) string {
+	return "Basic realm=" + quoteAuthParam(a.realm) + `, charset="UTF-8"`
+}
+
+// hasAuthScheme reports whether the Authorization header of r uses scheme.
+func hasAuthScheme(r *http.Request, scheme string) bool {
+	auth := r.Header.Get(gohttp.HeaderAuthorization)
+	return len(auth) > len(scheme) && strings.EqualFold(auth[:len(scheme)], scheme) && auth[len(scheme)] == ' '
+}
+
+// APIKeyLookup finds the principal owning an API key. It returns
+// ErrInvalidCredentials for unknown keys.
+type APIKeyLookup interface {
+	LookupAPIKey(ctx context.Context, key string) (*Principal, error)
+}
+
+// APIKeyLookupFunc is a function implementing APIKeyLookup.
+type APIKeyLookupFunc func(ctx context.Context, key string) (*Principal, error)
+
+func (f APIKeyLookupFunc) LookupAPIKey(ctx context.Context, key string) (*Principal, error) {
+	return f(ctx, key)
+}
+
+// StaticAPIKeys looks keys up in keys, mapping API keys to their owner, in a
+// time independent of the key.
+func StaticAPIKeys(keys map[string]string) APIKeyLookup {
+	return APIKeyLookupFunc(func(ctx context.Context, key string) (*Principal, error) {
+		var owner string
+		for k, o := range keys {
+			if secureCompare(k, key) {
+				owner = o
+			}
+		}
+		if owner == "" {
+			return nil, ErrInvalidCredentials
+		}
+		return &Principal{Subject: owner}, nil
+	})
+}
+
+type apiKeyAuthenticator struct {
+	realm  string
+	lookup APIKeyLookup
+	header string
+	query  string
+}
+
+type APIKeyOption func(*apiKeyAuthenticator)
+
+// APIKeyHeader sets the header carrying the key, X-API-Key by default. An
+// empty name disables the header.
+func APIKeyHeader(name string) APIKeyOption {
+	return func(a *apiKeyAuthenticator) {
+		a.header = name
+	}
+}
+
+// APIKeyQuery accepts the key in the query parameter param, when it is not
+// in the header. Keys in URLs end up in logs, prefer headers.
+func APIKeyQuery(param string) APIKeyOption {
+	return func(a *apiKeyAuthenticator) {
+		a.query = param
+	}
+}
+
+// NewAPIKeyAuthenticator authenticates the requests by API key, the owner of
+// the key being found by lookup.
+func NewAPIKeyAuthenticator(realm string, lookup APIKeyLookup, options ...APIKeyOption) Authenticator {
+	a := &apiKeyAuthenticator{realm: realm, lookup: lookup, header: "X-API-Key"}
+	for _, op := range options {
+		op(a)
+	}
+	return a
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	var key string
+	if a.header != "" {
+		key = r.Header.Get(a.header)
+	}
+	if key == "" && a.query != "" {
+		key = r.URL.Query().Get(a.query)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	p, err := a.lookup.LookupAPIKey(r.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+	principal := *p
+	principal.Scheme = "ApiKey"
+	return &principal, nil
+}
+
+// Challenge returns an ApiKey challenge. The scheme is not registered, the
+// challenge only tells clients where the key goes.
+func (a *apiKeyAuthenticator) Challenge(err error) string {
+	c := "ApiKey realm=" + quoteAuthParam(a.realm)
+	if a.header != "" {
+		c += ", header=" + quoteAuthParam(a.header)
+	}
+	if a.query != "" {
+		c += ", query=" + quoteAuthParam(a.query)
+	}
+	return c
+}
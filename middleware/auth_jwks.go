@@ -0,0 +1,341 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSCacheTTL = time.Hour
+	// minimum time between two loads triggered by unknown key ids
+	jwksMinRefreshInterval = time.Minute
+	// time between two attempts after a failed load, doubled on every
+	// failure up to the maximum
+	jwksMinRetryInterval = 5 * time.Second
+	jwksMaxRetryInterval = 5 * time.Minute
+	// time given to a load, independent of the requests waiting for it
+	jwksLoadTimeout = 10 * time.Second
+	// maximum size of a set fetched from a URL
+	jwksMaxSize = 1 << 20
+)
+
+// JWKS is a JWTKeySource serving the keys of a JSON Web Key Set, RFC 7517.
+// The set is loaded on first use and cached. Once the cache expires, the
+// cached keys keep being served while the set is loaded again in the
+// background; the set is also loaded again when a token names a key it does
+// not have. Failed loads are retried with an exponential backoff, the keys
+// of the last successful load being served meanwhile.
+type JWKS struct {
+	load   func(ctx context.Context) ([]byte, error)
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	keys     []jwk
+	loaded   bool
+	loadedAt time.Time
+	// loading is closed when the load in flight completes, nil when none is
+	loading  chan struct{}
+	loadErr  error
+	failures uint
+	retryAt  time.Time
+}
+
+type jwk struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+type JWKSOption func(*JWKS)
+
+// JWKSCacheTTL sets how long the set is cached, an hour by default.
+func JWKSCacheTTL(ttl time.Duration) JWKSOption {
+	return func(s *JWKS) {
+		s.ttl = ttl
+	}
+}
+
+// JWKSHTTPClient sets the client fetching the set from a URL,
+// http.DefaultClient by default.
+func JWKSHTTPClient(client *http.Client) JWKSOption {
+	return func(s *JWKS) {
+		s.client = client
+	}
+}
+
+// NewJWKSFromFile serves the keys of the set stored in the file path.
+func NewJWKSFromFile(path string, options ...JWKSOption) *JWKS {
+	s := newJWKS(options...)
+	s.load = func(ctx context.Context) ([]byte, error) {
+		return ioutil.ReadFile(path)
+	}
+	return s
+}
+
+// NewJWKSFromURL serves the keys of the set fetched from url.
+func NewJWKSFromURL(url string, options ...JWKSOption) *JWKS {
+	s := newJWKS(options...)
+	s.load = func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %s: %s", url, res.Status)
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(res.Body, jwksMaxSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > jwksMaxSize {
+			return nil, fmt.Errorf("fetching %s: key set larger than %d bytes", url, jwksMaxSize)
+		}
+		return data, nil
+	}
+	return s
+}
+
+func newJWKS(options ...JWKSOption) *JWKS {
+	s := &JWKS{
+		ttl:    defaultJWKSCacheTTL,
+		client: http.DefaultClient,
+		now:    time.Now,
+	}
+	for _, op := range options {
+		op(s)
+	}
+	return s
+}
+
+func (s *JWKS) VerificationKey(ctx context.Context, kid, alg string) (interface{}, error) {
+	s.mu.Lock()
+	now := s.now()
+	if !s.loaded {
+		loading := s.startLoad(now)
+		s.mu.Unlock()
+		if err := s.wait(ctx, loading); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+	} else if now.Sub(s.loadedAt) >= s.ttl {
+		// the expired keys are served until the new ones are loaded
+		s.startLoad(now)
+	}
+
+	key, ok := s.find(kid, alg)
+	if !ok && now.Sub(s.loadedAt) >= jwksMinRefreshInterval {
+		// the keys may have been rotated; when the set cannot be loaded,
+		// the key is unknown to the cached set
+		loading := s.startLoad(now)
+		s.mu.Unlock()
+		if err := s.wait(ctx, loading); err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		key, ok = s.find(kid, alg)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, jwtErrorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// startLoad starts loading the set, unless a load is in flight or a failed
+// load is backing off, and returns the channel closed once the load in
+// flight completes, nil when there is none. s.mu must be held.
+func (s *JWKS) startLoad(now time.Time) chan struct{} {
+	if s.loading != nil {
+		return s.loading
+	}
+	if now.Before(s.retryAt) {
+		return nil
+	}
+
+	s.loading = make(chan struct{})
+	go s.reload(s.loading)
+	return s.loading
+}
+
+// wait waits for the load closing loading, and returns its error, or the
+// error of the last load when loading is nil.
+func (s *JWKS) wait(ctx context.Context, loading chan struct{}) error {
+	if loading != nil {
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadErr
+}
+
+// reload loads the set, with a context of its own since the requests waiting
+// for it may give up, and closes done.
+func (s *JWKS) reload(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksLoadTimeout)
+	defer cancel()
+
+	data, err := s.load(ctx)
+	var keys []jwk
+	if err == nil {
+		keys, err = parseJWKS(data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer close(done)
+
+	s.loading = nil
+	if err != nil {
+		s.loadErr = fmt.Errorf("loading JWKS: %w", err)
+		s.failures++
+		backoff := jwksMaxRetryInterval
+		if s.failures < 8 && jwksMinRetryInterval<<(s.failures-1) < backoff {
+			backoff = jwksMinRetryInterval << (s.failures - 1)
+		}
+		s.retryAt = s.now().Add(backoff)
+		return
+	}
+
+	s.keys = keys
+	s.loaded = true
+	s.loadedAt = s.now()
+	s.loadErr = nil
+	s.failures = 0
+	s.retryAt = time.Time{}
+}
+
+// find returns the key of id kid usable with alg. Without kid, the set must
+// hold a single such key.
+func (s *JWKS) find(kid, alg string) (interface{}, bool) {
+	var found interface{}
+	n := 0
+	for _, k := range s.keys {
+		if (kid != "" && k.kid != kid) || (k.alg != "" && k.alg != alg) || !jwkFitsAlg(k.key, alg) {
+			continue
+		}
+		found = k.key
+		n++
+	}
+	return found, n == 1
+}
+
+func jwkFitsAlg(key interface{}, alg string) bool {
+	switch key.(type) {
+	case []byte:
+		return alg == JWTAlgHS256
+	case *rsa.PublicKey:
+		return alg == JWTAlgRS256
+	case *ecdsa.PublicKey:
+		return alg == JWTAlgES256
+	}
+	return false
+}
+
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS parses a key set, skipping the keys of other uses or of
+// unsupported types.
+func parseJWKS(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	var keys []jwk
+	for _, raw := range set.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+		key, err := raw.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", raw.Kid, err)
+		}
+		if key != nil {
+			keys = append(keys, jwk{kid: raw.Kid, alg: raw.Alg, key: key})
+		}
+	}
+	return keys, nil
+}
+
+func (raw rawJWK) publicKey() (interface{}, error) {
+	switch raw.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(raw.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(raw.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if raw.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeJWKInt(raw.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(raw.Y)
+		if err != nil {
+			return nil, err
+		}
+		curve := elliptic.P256()
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(raw.K)
+	}
+	return nil, nil
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,316 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+// Supported JWT signing algorithms.
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgES256 = "ES256"
+)
+
+// JWTKeySource provides the keys verifying the signature of tokens.
+type JWTKeySource interface {
+	// VerificationKey returns the key of id kid for alg: a []byte for HS256,
+	// an *rsa.PublicKey for RS256 and an *ecdsa.PublicKey for ES256. kid is
+	// empty when the token header has none.
+	VerificationKey(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+// JWTKeySourceFunc is a function implementing JWTKeySource.
+type JWTKeySourceFunc func(ctx context.Context, kid, alg string) (interface{}, error)
+
+func (f JWTKeySourceFunc) VerificationKey(ctx context.Context, kid, alg string) (interface{}, error) {
+	return f(ctx, kid, alg)
+}
+
+// JWTStaticKey verifies every token with key, whatever their kid.
+func JWTStaticKey(key interface{}) JWTKeySource {
+	return JWTKeySourceFunc(func(ctx context.Context, kid, alg string) (interface{}, error) {
+		return key, nil
+	})
+}
+
+// JWTError is the error of an invalid token. It wraps
+// ErrInvalidCredentials.
+type JWTError struct {
+	Reason string
+}
+
+func (e *JWTError) Error() string {
+	return "invalid token: " + e.Reason
+}
+
+func (e *JWTError) Unwrap() error {
+	return ErrInvalidCredentials
+}
+
+func jwtErrorf(format string, args ...interface{}) error {
+	return &JWTError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// JWTVerifier verifies the signature and the registered claims of JSON Web
+// Tokens.
+type JWTVerifier struct {
+	keys     JWTKeySource
+	algs     map[string]bool
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+type JWTOption func(*JWTVerifier)
+
+// JWTAlgorithms restricts the accepted signing algorithms, all the supported
+// ones by default.
+func JWTAlgorithms(algs ...string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.algs = map[string]bool{}
+		for _, alg := range algs {
+			v.algs[alg] = true
+		}
+	}
+}
+
+// JWTIssuer requires the iss claim to be issuer.
+func JWTIssuer(issuer string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.issuer = issuer
+	}
+}
+
+// JWTAudience requires the aud claim to contain audience.
+func JWTAudience(audience string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.audience = audience
+	}
+}
+
+// JWTLeeway sets the clock skew tolerated checking exp and nbf, none by
+// default.
+func JWTLeeway(leeway time.Duration) JWTOption {
+	return func(v *JWTVerifier) {
+		v.leeway = leeway
+	}
+}
+
+// NewJWTVerifier creates a verifier of the tokens signed with the keys of
+// keys.
+func NewJWTVerifier(keys JWTKeySource, options ...JWTOption) *JWTVerifier {
+	v := &JWTVerifier{
+		keys: keys,
+		algs: map[string]bool{JWTAlgHS256: true, JWTAlgRS256: true, JWTAlgES256: true},
+		now:  time.Now,
+	}
+	for _, op := range options {
+		op(v)
+	}
+	return v
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks token and returns its claims. Invalid tokens fail with a
+// *JWTError; other errors come from the key source.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, jwtErrorf("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, jwtErrorf("malformed header")
+	}
+	if !v.algs[header.Alg] {
+		return nil, jwtErrorf("unsupported algorithm %q", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, jwtErrorf("malformed signature")
+	}
+
+	key, err := v.keys.VerificationKey(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, jwtErrorf("malformed claims")
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func verifyJWTSignature(alg string, key interface{}, signingInput string, sig []byte) error {
+	hash := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case JWTAlgHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return jwtErrorf("no HMAC key for %s", alg)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return jwtErrorf("invalid signature")
+		}
+	case JWTAlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return jwtErrorf("no RSA key for %s", alg)
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig) != nil {
+			return jwtErrorf("invalid signature")
+		}
+	case JWTAlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve.Params().Name != "P-256" {
+			return jwtErrorf("no P-256 key for %s", alg)
+		}
+		if len(sig) != 64 {
+			return jwtErrorf("invalid signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, hash[:], r, s) {
+			return jwtErrorf("invalid signature")
+		}
+	default:
+		return jwtErrorf("unsupported algorithm %q", alg)
+	}
+	return nil
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}) error {
+	now := v.now()
+
+	if exp, ok, err := numericDate(claims, "exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(v.leeway)) {
+		return jwtErrorf("token expired")
+	}
+
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Add(v.leeway).Before(nbf) {
+		return jwtErrorf("token not valid yet")
+	}
+
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return jwtErrorf("unexpected issuer")
+		}
+	}
+
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return jwtErrorf("unexpected audience")
+	}
+	return nil
+}
+
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, jwtErrorf("malformed %s claim", name)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, jwtErrorf("malformed %s claim", name)
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true, nil
+}
+
+func hasAudience(aud interface{}, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []interface{}:
+		for _, v := range a {
+			if s, _ := v.(string); s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type jwtAuthenticator struct {
+	realm    string
+	verifier *JWTVerifier
+}
+
+// NewJWTAuthenticator authenticates the requests bearing a JSON Web Token in
+// their Authorization header, as in RFC 6750. The principal holds the sub
+// claim and all the claims of the token.
+func NewJWTAuthenticator(realm string, verifier *JWTVerifier) Authenticator {
+	return &jwtAuthenticator{realm: realm, verifier: verifier}
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if !hasAuthScheme(r, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	token := strings.TrimSpace(r.Header.Get(gohttp.HeaderAuthorization)[len("Bearer "):])
+	claims, err := a.verifier.Verify(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	return &Principal{Subject: sub, Scheme: "Bearer", Claims: claims}, nil
+}
+
+func (a *jwtAuthenticator) Challenge(err error) string {
+	c := "Bearer realm=" + quoteAuthParam(a.realm)
+
+	var jwtErr *JWTError
+	if errors.As(err, &jwtErr) {
+		c += `, error="invalid_token", error_description=` + quoteAuthParam(jwtErr.Reason)
+	}
+	return c
+}
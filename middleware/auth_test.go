@@ -0,0 +1,343 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/tj/assert"
+)
+
+func serveAuth(h http.Handler, setup func(r *http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if setup != nil {
+		setup(req)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+var principalHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	p, _ := PrincipalFromContext(r.Context())
+	_, _ = w.Write([]byte(p.Scheme + ":" + p.Subject))
+})
+
+func TestBasicAndAPIKeyAuthentication(t *testing.T) {
+	lookupErr := errors.New("key store down")
+	h := MakeHttpAuthenticationMiddleware(
+		NewBasicAuthenticator("admin", BasicUsers(map[string]string{"ann": "s3cret"})),
+		NewAPIKeyAuthenticator("api", APIKeyLookupFunc(func(ctx context.Context, key string) (*Principal, error) {
+			if key == "down" {
+				return nil, lookupErr
+			}
+			return StaticAPIKeys(map[string]string{"k-123": "billing"}).LookupAPIKey(ctx, key)
+		}), APIKeyQuery("api_key")),
+	)(principalHandler)
+
+	rec := serveAuth(h, func(r *http.Request) { r.SetBasicAuth("ann", "s3cret") })
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Basic:ann", rec.Body.String())
+
+	rec = serveAuth(h, func(r *http.Request) { r.SetBasicAuth("ann", "wrong") })
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, []string{`Basic realm="admin", charset="UTF-8"`}, rec.Header().Values(gohttp.HeaderWWWAuthenticate))
+
+	rec = serveAuth(h, func(r *http.Request) { r.Header.Set("X-API-Key", "k-123") })
+	assert.Equal(t, "ApiKey:billing", rec.Body.String())
+
+	rec = serveAuth(h, func(r *http.Request) { r.URL.RawQuery = "api_key=k-123" })
+	assert.Equal(t, "ApiKey:billing", rec.Body.String())
+
+	rec = serveAuth(h, func(r *http.Request) { r.Header.Set("X-API-Key", "nope") })
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, []string{`ApiKey realm="api", header="X-API-Key", query="api_key"`}, rec.Header().Values(gohttp.HeaderWWWAuthenticate))
+
+	rec = serveAuth(h, func(r *http.Request) { r.Header.Set("X-API-Key", "down") })
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "key store")
+
+	rec = serveAuth(h, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, []string{
+		`Basic realm="admin", charset="UTF-8"`,
+		`ApiKey realm="api", header="X-API-Key", query="api_key"`,
+	}, rec.Header().Values(gohttp.HeaderWWWAuthenticate))
+	assert.Equal(t, "{\"message\":\"authentication required\"}\n", rec.Body.String())
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	hb, _ := json.Marshal(header)
+	cb, _ := json.Marshal(claims)
+	input := b64(hb) + "." + b64(cb)
+	hash := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		assert.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return input + "." + b64(sig)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "ann", "iss": "auth.example", "aud": []string{"api", "web"}, "exp": now.Unix() + 60}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	keys := JWTKeySourceFunc(func(ctx context.Context, kid, alg string) (interface{}, error) {
+		switch kid {
+		case "hs":
+			return secret, nil
+		case "rs":
+			return &rsaKey.PublicKey, nil
+		case "es":
+			return &ecKey.PublicKey, nil
+		}
+		return nil, jwtErrorf("unknown key %q", kid)
+	})
+	v := NewJWTVerifier(keys, JWTIssuer("auth.example"), JWTAudience("api"), JWTLeeway(5*time.Second))
+	v.now = func() time.Time { return now }
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      interface{}
+	}{
+		{JWTAlgHS256, "hs", secret},
+		{JWTAlgRS256, "rs", rsaKey},
+		{JWTAlgES256, "es", ecKey},
+	} {
+		got, err := v.Verify(context.Background(), signJWT(t, tc.alg, tc.kid, tc.key, claims(nil)))
+		assert.NoError(t, err, tc.alg)
+		assert.Equal(t, "ann", got["sub"])
+	}
+
+	for reason, token := range map[string]string{
+		"token expired":            signJWT(t, JWTAlgHS256, "hs", secret, claims(map[string]interface{}{"exp": now.Unix() - 10})),
+		"token not valid yet":      signJWT(t, JWTAlgHS256, "hs", secret, claims(map[string]interface{}{"nbf": now.Unix() + 10})),
+		"unexpected issuer":        signJWT(t, JWTAlgHS256, "hs", secret, claims(map[string]interface{}{"iss": "evil"})),
+		"unexpected audience":      signJWT(t, JWTAlgHS256, "hs", secret, claims(map[string]interface{}{"aud": "other"})),
+		"invalid signature":        signJWT(t, JWTAlgHS256, "hs", []byte("other"), claims(nil)),
+		`unsupported algorithm ""`: strings.Replace(signJWT(t, JWTAlgHS256, "hs", secret, claims(nil)), b64([]byte(`{"alg":"HS256","kid":"hs","typ":"JWT"}`)), b64([]byte(`{"kid":"hs"}`)), 1),
+		"no HMAC key for HS256":    signJWT(t, JWTAlgHS256, "rs", []byte("public key bytes"), claims(nil)),
+		"no RSA key for RS256":     signJWT(t, JWTAlgRS256, "hs", rsaKey, claims(nil)),
+		"malformed token":          "abc.def",
+	} {
+		_, err := v.Verify(context.Background(), token)
+		var jwtErr *JWTError
+		assert.True(t, errors.As(err, &jwtErr), reason)
+		if jwtErr != nil {
+			assert.Equal(t, reason, jwtErr.Reason)
+		}
+		assert.True(t, errors.Is(err, ErrInvalidCredentials))
+	}
+
+	// leeway
+	_, err = v.Verify(context.Background(), signJWT(t, JWTAlgHS256, "hs", secret, claims(map[string]interface{}{"exp": now.Unix() - 2})))
+	assert.NoError(t, err)
+
+	hsOnly := NewJWTVerifier(keys, JWTAlgorithms(JWTAlgRS256))
+	_, err = hsOnly.Verify(context.Background(), signJWT(t, JWTAlgHS256, "hs", secret, map[string]interface{}{}))
+	assert.EqualError(t, err, `invalid token: unsupported algorithm "HS256"`)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	secret := []byte("secret")
+	h := MakeHttpAuthenticationMiddleware(NewJWTAuthenticator("api", NewJWTVerifier(JWTStaticKey(secret))))(principalHandler)
+
+	token := signJWT(t, JWTAlgHS256, "", secret, map[string]interface{}{"sub": "ann", "exp": time.Now().Add(time.Minute).Unix()})
+	rec := serveAuth(h, func(r *http.Request) { r.Header.Set(gohttp.HeaderAuthorization, "Bearer "+token) })
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Bearer:ann", rec.Body.String())
+
+	token = signJWT(t, JWTAlgHS256, "", secret, map[string]interface{}{"sub": "ann", "exp": time.Now().Add(-time.Minute).Unix()})
+	rec = serveAuth(h, func(r *http.Request) { r.Header.Set(gohttp.HeaderAuthorization, "bearer "+token) })
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="api", error="invalid_token", error_description="token expired"`, rec.Header().Get(gohttp.HeaderWWWAuthenticate))
+
+	rec = serveAuth(h, func(r *http.Request) { r.SetBasicAuth("ann", "x") })
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="api"`, rec.Header().Get(gohttp.HeaderWWWAuthenticate))
+}
+
+func jwkInt(i *big.Int) string {
+	return b64(i.Bytes())
+}
+
+// waitJWKSLoad waits for the load of s in flight, if any.
+func waitJWKSLoad(s *JWKS) {
+	s.mu.Lock()
+	loading := s.loading
+	s.mu.Unlock()
+	if loading != nil {
+		<-loading
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	set := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rs-1", "alg": "RS256", "use": "sig", "n": jwkInt(rsaKey.N), "e": jwkInt(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "es-1", "crv": "P-256", "x": jwkInt(ecKey.X), "y": jwkInt(ecKey.Y)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": jwkInt(rsaKey.N), "e": "AQAB"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"},
+	}}
+	data, _ := json.Marshal(set)
+
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1700000000, 0)
+	jwks := NewJWKSFromURL(srv.URL, JWKSCacheTTL(10*time.Minute))
+	jwks.now = func() time.Time { return now }
+	v := NewJWTVerifier(jwks)
+
+	_, err = v.Verify(context.Background(), signJWT(t, JWTAlgRS256, "rs-1", rsaKey, map[string]interface{}{"sub": "a"}))
+	assert.NoError(t, err)
+	_, err = v.Verify(context.Background(), signJWT(t, JWTAlgES256, "es-1", ecKey, map[string]interface{}{"sub": "a"}))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// an RS256 key is not used for ES256
+	_, err = v.Verify(context.Background(), signJWT(t, JWTAlgES256, "rs-1", ecKey, map[string]interface{}{}))
+	assert.EqualError(t, err, `invalid token: unknown key "rs-1"`)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// unknown keys trigger a reload once the refresh interval passed
+	now = now.Add(2 * time.Minute)
+	_, err = v.Verify(context.Background(), signJWT(t, JWTAlgRS256, "rotated", rsaKey, map[string]interface{}{}))
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	// expired keys are served while the set is loaded again
+	now = now.Add(10 * time.Minute)
+	_, err = v.Verify(context.Background(), signJWT(t, JWTAlgRS256, "rs-1", rsaKey, map[string]interface{}{}))
+	assert.NoError(t, err)
+	waitJWKSLoad(jwks)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fetches))
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, ioutil.WriteFile(path, data, 0600))
+	v = NewJWTVerifier(NewJWKSFromFile(path))
+	_, err = v.Verify(context.Background(), signJWT(t, JWTAlgES256, "", ecKey, map[string]interface{}{}))
+	assert.NoError(t, err)
+
+	v = NewJWTVerifier(NewJWKSFromFile(filepath.Join(t.TempDir(), "missing.json")))
+	_, err = v.Verify(context.Background(), signJWT(t, JWTAlgES256, "", ecKey, map[string]interface{}{}))
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrInvalidCredentials))
+}
+
+func TestJWKSUnavailable(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	data, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "EC", "kid": "es-1", "crv": "P-256", "x": jwkInt(ecKey.X), "y": jwkInt(ecKey.Y)},
+	}})
+
+	var fetches, down int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1700000000, 0)
+	jwks := NewJWKSFromURL(srv.URL, JWKSCacheTTL(10*time.Minute))
+	jwks.now = func() time.Time { return now }
+	v := NewJWTVerifier(jwks)
+	verify := func(kid string) error {
+		_, err := v.Verify(context.Background(), signJWT(t, JWTAlgES256, kid, ecKey, map[string]interface{}{}))
+		waitJWKSLoad(jwks)
+		return err
+	}
+
+	assert.NoError(t, verify("es-1"))
+	atomic.StoreInt32(&down, 1)
+
+	// the cached keys outlive a failed load
+	now = now.Add(10 * time.Minute)
+	assert.NoError(t, verify("es-1"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+
+	// failed loads back off, 5s then 10s
+	assert.NoError(t, verify("es-1"))
+	now = now.Add(4 * time.Second)
+	assert.NoError(t, verify("es-1"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+	now = now.Add(2 * time.Second)
+	assert.NoError(t, verify("es-1"))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fetches))
+	now = now.Add(6 * time.Second)
+	err = verify("unknown")
+	assert.EqualError(t, err, `invalid token: unknown key "unknown"`)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fetches))
+
+	atomic.StoreInt32(&down, 0)
+	now = now.Add(5 * time.Second)
+	assert.NoError(t, verify("es-1"))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&fetches))
+	assert.NoError(t, verify("es-1"))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&fetches))
+}
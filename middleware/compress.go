@@ -0,0 +1,390 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// DefaultCompressionMinSize is the size under which bodies are not
+// compressed by default.
+const DefaultCompressionMinSize = 1024
+
+// DefaultSkippedContentTypes are the content types not compressed by
+// default, being compressed already. Entries ending with "/" match every
+// subtype.
+var DefaultSkippedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/zstd",
+}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+type compressionConfig struct {
+	minSize int
+	level   int
+	skipped []string
+	pools   map[string]*sync.Pool
+}
+
+type CompressionOption func(*compressionConfig)
+
+// CompressionMinSize sets the size under which bodies are not compressed,
+// DefaultCompressionMinSize by default.
+func CompressionMinSize(n int) CompressionOption {
+	return func(c *compressionConfig) {
+		c.minSize = n
+	}
+}
+
+// CompressionLevel sets the compression level, from flate.BestSpeed to
+// flate.BestCompression, flate.DefaultCompression by default.
+func CompressionLevel(level int) CompressionOption {
+	return func(c *compressionConfig) {
+		c.level = level
+	}
+}
+
+// CompressionSkipContentTypes adds content types not to compress to
+// DefaultSkippedContentTypes.
+func CompressionSkipContentTypes(types ...string) CompressionOption {
+	return func(c *compressionConfig) {
+		c.skipped = append(c.skipped, types...)
+	}
+}
+
+// MakeHttpCompressionMiddleware returns a middleware compressing responses
+// with the encoding preferred by the Accept-Encoding header of the request,
+// gzip or deflate. Bodies under the minimum size, of skipped content types,
+// or already encoded by the handler are sent as is. Compressed responses
+// lose their Content-Length, and compressible ones get
+// Vary: Accept-Encoding.
+func MakeHttpCompressionMiddleware(options ...CompressionOption) func(http.Handler) http.Handler {
+	cfg := &compressionConfig{
+		minSize: DefaultCompressionMinSize,
+		level:   flate.DefaultCompression,
+		skipped: append([]string{}, DefaultSkippedContentTypes...),
+	}
+	for _, op := range options {
+		op(cfg)
+	}
+
+	if _, err := flate.NewWriter(nil, cfg.level); err != nil {
+		panic(err)
+	}
+	cfg.pools = map[string]*sync.Pool{
+		EncodingGzip: {New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, cfg.level)
+			return w
+		}},
+		EncodingDeflate: {New: func() interface{} {
+			w, _ := flate.NewWriter(nil, cfg.level)
+			return w
+		}},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiateEncoding(r.Header.Get(gohttp.HeaderAcceptEncoding))
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get(gohttp.HeaderUpgrade) != "" {
+				w.Header().Add(gohttp.HeaderVary, gohttp.HeaderAcceptEncoding)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, cfg: cfg, encoding: encoding}
+			defer cw.close()
+			next.ServeHTTP(cw.wrap(), r)
+		})
+	}
+}
+
+// negotiateEncoding returns the supported encoding of the highest quality in
+// an Accept-Encoding header, gzip winning ties, or "" for none.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = v
+				}
+			}
+		}
+		if name != "" {
+			q[name] = quality
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range []string{EncodingGzip, EncodingDeflate} {
+		v, ok := q[enc]
+		if !ok {
+			v, ok = q["*"]
+		}
+		if ok && v > bestQ {
+			best, bestQ = enc, v
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of the body until it knows whether to
+// compress it.
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      *compressionConfig
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     compressor
+	// hijacked is set once the handler took over the connection
+	hijacked bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code < http.StatusOK && code != http.StatusSwitchingProtocols {
+		// informational responses are sent right away
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status == 0 {
+		cw.status = code
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.cfg.minSize {
+			return len(b), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// wrap returns cw with the optional interfaces of the underlying writer, so
+// that the handler only sees the ones it can use.
+func (cw *compressWriter) wrap() http.ResponseWriter {
+	_, isFlusher := cw.ResponseWriter.(http.Flusher)
+	_, isHijacker := cw.ResponseWriter.(http.Hijacker)
+	_, isPusher := cw.ResponseWriter.(http.Pusher)
+	f, h, p := compressFlusher{cw}, compressHijacker{cw}, compressPusher{cw}
+
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*compressWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{cw, f, h, p}
+	case isFlusher && isHijacker:
+		return struct {
+			*compressWriter
+			http.Flusher
+			http.Hijacker
+		}{cw, f, h}
+	case isFlusher && isPusher:
+		return struct {
+			*compressWriter
+			http.Flusher
+			http.Pusher
+		}{cw, f, p}
+	case isHijacker && isPusher:
+		return struct {
+			*compressWriter
+			http.Hijacker
+			http.Pusher
+		}{cw, h, p}
+	case isFlusher:
+		return struct {
+			*compressWriter
+			http.Flusher
+		}{cw, f}
+	case isHijacker:
+		return struct {
+			*compressWriter
+			http.Hijacker
+		}{cw, h}
+	case isPusher:
+		return struct {
+			*compressWriter
+			http.Pusher
+		}{cw, p}
+	}
+	return cw
+}
+
+type compressFlusher struct{ cw *compressWriter }
+
+// Flush commits to compressing the response, of unknown size, when it is
+// compressible.
+func (f compressFlusher) Flush() {
+	cw := f.cw
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		_ = cw.decide(true)
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	cw.ResponseWriter.(http.Flusher).Flush()
+}
+
+type compressHijacker struct{ cw *compressWriter }
+
+// Hijack hands the connection over to the handler; nothing is compressed or
+// written through the writer afterwards.
+func (h compressHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := h.cw.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		h.cw.hijacked = true
+	}
+	return conn, buf, err
+}
+
+type compressPusher struct{ cw *compressWriter }
+
+func (p compressPusher) Push(target string, opts *http.PushOptions) error {
+	return p.cw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// decide writes the header, compressing the body when it is large enough and
+// compressible, and then the buffered body.
+func (cw *compressWriter) decide(large bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	if h.Get(gohttp.HeaderContentType) == "" && len(cw.buf) > 0 {
+		h.Set(gohttp.HeaderContentType, http.DetectContentType(cw.buf))
+	}
+
+	if cw.compressible() {
+		h.Add(gohttp.HeaderVary, gohttp.HeaderAcceptEncoding)
+		if large {
+			h.Del(gohttp.HeaderContentLength)
+			h.Set(gohttp.HeaderContentEncoding, cw.encoding)
+			cw.enc = cw.cfg.pools[cw.encoding].Get().(compressor)
+			cw.enc.Reset(cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (cw *compressWriter) compressible() bool {
+	switch cw.status {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified, http.StatusSwitchingProtocols:
+		return false
+	}
+
+	h := cw.Header()
+	if h.Get(gohttp.HeaderContentEncoding) != "" {
+		return false
+	}
+
+	ct := strings.ToLower(h.Get(gohttp.HeaderContentType))
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	ct = strings.TrimSpace(ct)
+	if ct == "image/svg+xml" {
+		return true
+	}
+	for _, skipped := range cw.cfg.skipped {
+		if ct == skipped || strings.HasSuffix(skipped, "/") && strings.HasPrefix(ct, skipped) {
+			return false
+		}
+	}
+	return true
+}
+
+// close sends what is left of the response once the handler returns.
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		if cw.status == 0 {
+			// nothing written, the server answers 200 as usual
+			return
+		}
+		_ = cw.decide(false)
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		cw.enc.Reset(nil)
+		cw.cfg.pools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/tj/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                          "",
+		"gzip":                      "gzip",
+		"deflate, gzip":             "gzip",
+		"deflate;q=1, gzip;q=0.5":   "deflate",
+		"gzip;q=0":                  "",
+		"gzip;q=0, deflate":         "deflate",
+		"br":                        "",
+		"br, *;q=0.1":               "gzip",
+		"*;q=0.5, gzip;q=0":         "deflate",
+		"GZIP; q=0.8, identity":     "gzip",
+		"identity;q=1, deflate;q=0": "",
+	} {
+		assert.Equal(t, want, negotiateEncoding(header), header)
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat("compress me please ", 200)
+
+	h := MakeHttpCompressionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Header().Set(gohttp.HeaderContentType, "text/plain")
+			w.Header().Set(gohttp.HeaderContentLength, strconv.Itoa(len(large)))
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(large[:10]))
+			_, _ = w.Write([]byte(large[10:]))
+		case "/small":
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		case "/image":
+			w.Header().Set(gohttp.HeaderContentType, "image/png")
+			_, _ = w.Write([]byte(large))
+		case "/encoded":
+			w.Header().Set(gohttp.HeaderContentEncoding, "br")
+			_, _ = w.Write([]byte(large))
+		case "/stream":
+			_, _ = w.Write([]byte("data: 1\n\n"))
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte("data: 2\n\n"))
+		}
+	}))
+
+	serve := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(gohttp.HeaderAcceptEncoding, acceptEncoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/large", "gzip")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get(gohttp.HeaderContentEncoding))
+	assert.Equal(t, gohttp.HeaderAcceptEncoding, rec.Header().Get(gohttp.HeaderVary))
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderContentLength))
+	gz, err := gzip.NewReader(rec.Body)
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(gz)
+	assert.Equal(t, large, string(body))
+
+	rec = serve("/large", "deflate")
+	assert.Equal(t, "deflate", rec.Header().Get(gohttp.HeaderContentEncoding))
+	body, _ = ioutil.ReadAll(flate.NewReader(rec.Body))
+	assert.Equal(t, large, string(body))
+
+	rec = serve("/large", "")
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderContentEncoding))
+	assert.Equal(t, gohttp.HeaderAcceptEncoding, rec.Header().Get(gohttp.HeaderVary))
+	assert.Equal(t, large, rec.Body.String())
+
+	rec = serve("/small", "gzip")
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderContentEncoding))
+	assert.Equal(t, gohttp.HeaderAcceptEncoding, rec.Header().Get(gohttp.HeaderVary))
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get(gohttp.HeaderContentType))
+	assert.Equal(t, `{"ok":true}`, rec.Body.String())
+
+	rec = serve("/image", "gzip")
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderContentEncoding))
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderVary))
+	assert.Equal(t, large, rec.Body.String())
+
+	rec = serve("/encoded", "gzip")
+	assert.Equal(t, "br", rec.Header().Get(gohttp.HeaderContentEncoding))
+	assert.Equal(t, large, rec.Body.String())
+
+	rec = serve("/stream", "gzip")
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "gzip", rec.Header().Get(gohttp.HeaderContentEncoding))
+	gz, err = gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	assert.NoError(t, err)
+	body, _ = ioutil.ReadAll(gz)
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", string(body))
+}
+
+// plainResponseWriter hides the optional interfaces of the recorder.
+type plainResponseWriter struct {
+	http.ResponseWriter
+}
+
+func TestCompressionMiddlewareInterfaces(t *testing.T) {
+	var isFlusher, isHijacker, isPusher bool
+	hijack := false
+	h := MakeHttpCompressionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isFlusher = w.(http.Flusher)
+		_, isHijacker = w.(http.Hijacker)
+		_, isPusher = w.(http.Pusher)
+		if hijack {
+			_, _, _ = w.(http.Hijacker).Hijack()
+			return
+		}
+		_, _ = w.Write([]byte(strings.Repeat("compress me please ", 200)))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(gohttp.HeaderAcceptEncoding, "gzip")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(plainResponseWriter{rec}, req)
+	assert.False(t, isFlusher)
+	assert.False(t, isHijacker)
+	assert.False(t, isPusher)
+	assert.Equal(t, "gzip", rec.Header().Get(gohttp.HeaderContentEncoding))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(hijackableRecorder{rec}, req)
+	assert.True(t, isFlusher)
+	assert.True(t, isHijacker)
+	assert.False(t, isPusher)
+
+	// nothing is written once the connection is hijacked
+	hijack = true
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(hijackableRecorder{rec}, req)
+	assert.True(t, isHijacker)
+	assert.False(t, rec.Flushed)
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderContentEncoding))
+	assert.Equal(t, 0, rec.Body.Len())
+}
+
+func BenchmarkCompressionMiddleware(b *testing.B) {
+	body := []byte(strings.Repeat(`{"id":1,"name":"compress me"},`, 100))
+	h := MakeHttpCompressionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(gohttp.HeaderAcceptEncoding, "gzip")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
@@ -0,0 +1,334 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+const (
+	// DefaultDecompressedMaxSize is the maximum size of a decompressed body
+	// by default.
+	DefaultDecompressedMaxSize = 32 << 20
+	// DefaultDecompressionMaxRatio is the maximum ratio between the
+	// decompressed and the compressed size of a body by default.
+	DefaultDecompressionMaxRatio = 100
+
+	// bodies under this size are not checked for their ratio, small inputs
+	// of repeated data legitimately compressing very well
+	decompressionRatioFloor = 64 << 10
+)
+
+// DecompressionLimitError is returned by the reads of a decompressed body
+// exceeding a limit. The middleware then answers 413 Request Entity Too
+// Large, unless the handler already wrote the response header.
+type DecompressionLimitError struct {
+	Reason string
+}
+
+func (e *DecompressionLimitError) Error() string {
+	return "decompressed request body " + e.Reason
+}
+
+type decompressionConfig struct {
+	maxSize  int64
+	maxRatio int64
+}
+
+type DecompressionOption func(*decompressionConfig)
+
+// DecompressionMaxSize sets the maximum size of a decompressed body,
+// DefaultDecompressedMaxSize by default.
+func DecompressionMaxSize(n int64) DecompressionOption {
+	return func(c *decompressionConfig) {
+		c.maxSize = n
+	}
+}
+
+// DecompressionMaxRatio sets the maximum ratio between the decompressed and
+// the compressed size of a body, DefaultDecompressionMaxRatio by default.
+// Zero disables the check.
+func DecompressionMaxRatio(ratio int64) DecompressionOption {
+	return func(c *decompressionConfig) {
+		c.maxRatio = ratio
+	}
+}
+
+// MakeHttpRequestDecompressionMiddleware returns a middleware decoding the
+// request bodies encoded with gzip or deflate, as stated by their
+// Content-Encoding header, which is removed along with Content-Length.
+// Requests with another encoding are answered with 415 Unsupported Media
+// Type. The decompressed body is limited in size and compression ratio, to
+// defeat zip bombs; MakeHttpRequestBodySizeLimiterMiddleware, used before
+// it, limits the compressed size.
+func MakeHttpRequestDecompressionMiddleware(options ...DecompressionOption) func(http.Handler) http.Handler {
+	cfg := &decompressionConfig{
+		maxSize:  DefaultDecompressedMaxSize,
+		maxRatio: DefaultDecompressionMaxRatio,
+	}
+	for _, op := range options {
+		op(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encodings := contentEncodings(r.Header.Get(gohttp.HeaderContentEncoding))
+			if len(encodings) == 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, enc := range encodings {
+				if enc != EncodingGzip && enc != EncodingDeflate {
+					w.Header().Set(gohttp.HeaderAcceptEncoding, EncodingGzip+", "+EncodingDeflate)
+					writeJSONError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content encoding %q", enc))
+					return
+				}
+			}
+
+			in := &countingReader{r: r.Body}
+			var body io.Reader = in
+			var closers []io.Closer
+			// encodings are listed in the order they were applied
+			for i := len(encodings) - 1; i >= 0; i-- {
+				dec, err := newDecompressor(encodings[i], body)
+				if err != nil {
+					for _, c := range closers {
+						_ = c.Close()
+					}
+					writeJSONError(w, http.StatusBadRequest, "invalid "+encodings[i]+" request body")
+					return
+				}
+				closers = append(closers, dec)
+				body = dec
+			}
+
+			lr := &decompressedBody{cfg: cfg, in: in, r: body, closers: append(closers, r.Body)}
+
+			r.Header.Del(gohttp.HeaderContentEncoding)
+			r.Header.Del(gohttp.HeaderContentLength)
+			r.ContentLength = -1
+			r.Body = lr
+
+			dw := &decompressionResponseWriter{ResponseWriter: w, body: lr}
+			next.ServeHTTP(dw.wrap(), r)
+			if !dw.written && lr.err != nil {
+				dw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
+
+func contentEncodings(header string) []string {
+	var encodings []string
+	for _, enc := range strings.Split(header, ",") {
+		enc = strings.ToLower(strings.TrimSpace(enc))
+		if enc != "" && enc != "identity" {
+			encodings = append(encodings, enc)
+		}
+	}
+	return encodings
+}
+
+// newDecompressor reads deflate bodies both with and without the zlib
+// wrapper, as clients disagree on it.
+func newDecompressor(encoding string, r io.Reader) (io.ReadCloser, error) {
+	if encoding == EncodingGzip {
+		return gzip.NewReader(r)
+	}
+
+	br := bufio.NewReader(r)
+	if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decompressedBody enforces the limits of the decompressed body.
+type decompressedBody struct {
+	cfg     *decompressionConfig
+	in      *countingReader
+	r       io.Reader
+	closers []io.Closer
+	n       int64
+	err     *DecompressionLimitError
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+
+	switch {
+	case b.n > b.cfg.maxSize:
+		b.err = &DecompressionLimitError{Reason: fmt.Sprintf("exceeds %d bytes", b.cfg.maxSize)}
+	case b.cfg.maxRatio > 0 && b.n > decompressionRatioFloor && b.n > b.in.n*b.cfg.maxRatio:
+		b.err = &DecompressionLimitError{Reason: fmt.Sprintf("exceeds a compression ratio of %d", b.cfg.maxRatio)}
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return n, err
+}
+
+func (b *decompressedBody) Close() error {
+	var err error
+	for _, c := range b.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// decompressionResponseWriter replaces the response of a handler which read
+// past the limits of the body with a 413.
+type decompressionResponseWriter struct {
+	http.ResponseWriter
+	body     *decompressedBody
+	replaced bool
+	written  bool
+}
+
+func (w *decompressionResponseWriter) WriteHeader(code int) {
+	if w.written {
+		return
+	}
+	w.written = true
+
+	if w.body.err != nil {
+		w.replaced = true
+		writeJSONError(w.ResponseWriter, http.StatusRequestEntityTooLarge, w.body.err.Error())
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *decompressionResponseWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *decompressionResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// wrap returns w with the optional interfaces of the underlying writer, so
+// that the handler only sees the ones it can use.
+func (w *decompressionResponseWriter) wrap() http.ResponseWriter {
+	_, isFlusher := w.ResponseWriter.(http.Flusher)
+	_, isHijacker := w.ResponseWriter.(http.Hijacker)
+	_, isPusher := w.ResponseWriter.(http.Pusher)
+	f, h, p := decompressionFlusher{w}, decompressionHijacker{w}, decompressionPusher{w}
+
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*decompressionResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, f, h, p}
+	case isFlusher && isHijacker:
+		return struct {
+			*decompressionResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{w, f, h}
+	case isFlusher && isPusher:
+		return struct {
+			*decompressionResponseWriter
+			http.Flusher
+			http.Pusher
+		}{w, f, p}
+	case isHijacker && isPusher:
+		return struct {
+			*decompressionResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case isFlusher:
+		return struct {
+			*decompressionResponseWriter
+			http.Flusher
+		}{w, f}
+	case isHijacker:
+		return struct {
+			*decompressionResponseWriter
+			http.Hijacker
+		}{w, h}
+	case isPusher:
+		return struct {
+			*decompressionResponseWriter
+			http.Pusher
+		}{w, p}
+	}
+	return w
+}
+
+type decompressionFlusher struct{ w *decompressionResponseWriter }
+
+// Flush writes the header, replaced when the body exceeded its limits, and
+// then flushes the response.
+func (f decompressionFlusher) Flush() {
+	if !f.w.written {
+		f.w.WriteHeader(http.StatusOK)
+	}
+	if !f.w.replaced {
+		f.w.ResponseWriter.(http.Flusher).Flush()
+	}
+}
+
+type decompressionHijacker struct{ w *decompressionResponseWriter }
+
+// Hijack hands the connection over to the handler; no response is written
+// through the writer afterwards.
+func (h decompressionHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := h.w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		h.w.written = true
+	}
+	return conn, buf, err
+}
+
+type decompressionPusher struct{ w *decompressionResponseWriter }
+
+func (p decompressionPusher) Push(target string, opts *http.PushOptions) error {
+	return p.w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	h := w.Header()
+	h.Del(gohttp.HeaderContentLength)
+	h.Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/tj/assert"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	default:
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	_, err := w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestRequestDecompression(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-Seen-Encoding", r.Header.Get(gohttp.HeaderContentEncoding))
+		_ = json.NewEncoder(w).Encode(v)
+	})
+
+	serve := func(h http.Handler, encoding string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set(gohttp.HeaderContentEncoding, encoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	h := MakeHttpRequestDecompressionMiddleware()(echo)
+	payload := []byte(`{"name":"ann"}`)
+
+	for _, enc := range []struct{ header, format string }{
+		{"gzip", "gzip"},
+		{"deflate", "zlib"},
+		{"deflate", "flate"},
+		{"identity", ""},
+	} {
+		body := payload
+		seen := enc.header
+		if enc.format != "" {
+			body = compress(t, enc.format, payload)
+			seen = ""
+		}
+		rec := serve(h, enc.header, body)
+		assert.Equal(t, http.StatusOK, rec.Code, enc.format)
+		assert.Equal(t, seen, rec.Header().Get("X-Seen-Encoding"))
+		assert.Equal(t, "{\"name\":\"ann\"}\n", rec.Body.String(), enc.format)
+	}
+
+	// encodings applied in turn
+	rec := serve(h, "deflate, gzip", compress(t, "gzip", compress(t, "zlib", payload)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(h, "br", payload)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Equal(t, "gzip, deflate", rec.Header().Get(gohttp.HeaderAcceptEncoding))
+
+	rec = serve(h, "gzip", payload)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// the outer decoder is built before the inner one fails
+	rec = serve(h, "gzip, gzip", compress(t, "gzip", payload))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// a zip bomb trips the ratio limit long before the size limit
+	bomb := compress(t, "gzip", []byte(`{"pad":"`+strings.Repeat("0", 10<<20)+`"}`))
+	rec = serve(h, "gzip", bomb)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "compression ratio of 100")
+
+	h = MakeHttpRequestDecompressionMiddleware(DecompressionMaxSize(1<<20), DecompressionMaxRatio(0))(echo)
+	rec = serve(h, "gzip", bomb)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "exceeds 1048576 bytes")
+
+	// handlers ignoring the read error still answer 413
+	h = MakeHttpRequestDecompressionMiddleware(DecompressionMaxSize(10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+	}))
+	rec = serve(h, "gzip", compress(t, "gzip", payload))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestRequestDecompressionInterfaces(t *testing.T) {
+	var isFlusher, isHijacker, isPusher bool
+	h := MakeHttpRequestDecompressionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isFlusher = w.(http.Flusher)
+		_, isHijacker = w.(http.Hijacker)
+		_, isPusher = w.(http.Pusher)
+	}))
+
+	serve := func(w http.ResponseWriter) {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compress(t, "gzip", []byte("{}"))))
+		req.Header.Set(gohttp.HeaderContentEncoding, "gzip")
+		h.ServeHTTP(w, req)
+	}
+
+	serve(plainResponseWriter{httptest.NewRecorder()})
+	assert.False(t, isFlusher)
+	assert.False(t, isHijacker)
+	assert.False(t, isPusher)
+
+	serve(hijackableRecorder{httptest.NewRecorder()})
+	assert.True(t, isFlusher)
+	assert.True(t, isHijacker)
+	assert.False(t, isPusher)
+}
@@ -5,29 +5,119 @@ import (
 
 	log "github.com/likearthian/go-logger"
 	"github.com/likearthian/go-logger/level"
-	"github.com/ua-parser/uap-go/uaparser"
 )
 
-func MakeHttpTransportLoggingMiddleware(logger log.Logger) func(http.Handler) http.Handler {
+// RedactedHeaderValue replaces the values of redacted headers in logs.
+const RedactedHeaderValue = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers redacted from logs by default.
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Signature",
+	"X-Api-Key",
+	"X-CSRF-Token",
+}
+
+type loggingConfig struct {
+	redact   map[string]bool
+	allow    map[string]bool
+	uaParser *UserAgentParser
+}
+
+type LoggingOption func(*loggingConfig)
+
+// LoggingRedactHeaders redacts headers from the logs, in addition to
+// DefaultRedactedHeaders.
+func LoggingRedactHeaders(names ...string) LoggingOption {
+	return func(c *loggingConfig) {
+		for _, n := range names {
+			c.redact[http.CanonicalHeaderKey(n)] = true
+		}
+	}
+}
+
+// LoggingAllowHeaders switches to an allowlist: only the named headers are
+// logged, the redacted ones still being masked.
+func LoggingAllowHeaders(names ...string) LoggingOption {
+	return func(c *loggingConfig) {
+		if c.allow == nil {
+			c.allow = map[string]bool{}
+		}
+		for _, n := range names {
+			c.allow[http.CanonicalHeaderKey(n)] = true
+		}
+	}
+}
+
+// LoggingUserAgentParser sets the parser of the User-Agent header, a parser
+// shared by the middlewares and caching 1024 user agents by default.
+func LoggingUserAgentParser(p *UserAgentParser) LoggingOption {
+	return func(c *loggingConfig) {
+		c.uaParser = p
+	}
+}
+
+// MakeHttpTransportLoggingMiddleware returns a middleware logging every
+// request once it is served, with its status, size, latency and the matched
+// route pattern. The URI is logged only for requests matching no route.
+// Sensitive headers are redacted, see DefaultRedactedHeaders.
+func MakeHttpTransportLoggingMiddleware(logger log.Logger, options ...LoggingOption) func(http.Handler) http.Handler {
+	cfg := &loggingConfig{
+		redact:   map[string]bool{},
+		uaParser: defaultUserAgentParser,
+	}
+	LoggingRedactHeaders(DefaultRedactedHeaders...)(cfg)
+	for _, op := range options {
+		op(cfg)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			reqid := r.Header.Get("X-Request-Id")
-
-			ua := uaparser.NewFromSaved()
-			cl := ua.Parse(r.Header.Get("User-Agent"))
-			_ = level.Info(logger).Log(
-				"event", "incoming request",
-				"request-id", reqid,
-				"uri", r.RequestURI,
-				"method", r.Method,
-				"headers", r.Header,
+			entry := serveLogged(next, w, r)
+
+			cl := cfg.uaParser.Parse(r.Header.Get("User-Agent"))
+
+			keyvals := []interface{}{
+				"event", "request completed",
+				"request-id", entry.RequestID,
+				"method", entry.Method,
+				"route", entry.Route,
+			}
+			if entry.Route == "" {
+				keyvals = append(keyvals, "uri", entry.URI)
+			}
+			keyvals = append(keyvals,
+				"status", entry.Status,
+				"bytes", entry.Bytes,
+				"latency", entry.Latency,
+				"ttfb", entry.TTFB,
+				"headers", cfg.headers(r.Header),
 				"origin", r.Header.Get("X-Forwarded-For"),
 				"protocol", r.Proto,
 				"user-agent", cl.UserAgent.ToString(),
 				"device", cl.Device.ToString(),
 				"os", cl.Os.ToString(),
 			)
-			next.ServeHTTP(w, r)
+			_ = level.Info(logger).Log(keyvals...)
 		})
 	}
 }
+
+// headers returns a copy of h fit for the logs.
+func (c *loggingConfig) headers(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		ck := http.CanonicalHeaderKey(k)
+		if c.allow != nil && !c.allow[ck] {
+			continue
+		}
+		if c.redact[ck] {
+			v = []string{RedactedHeaderValue}
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/likearthian/go-logger"
+	"github.com/tj/assert"
+	"github.com/ua-parser/uap-go/uaparser"
+)
+
+const testUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+func captureLogger(fields map[string]interface{}) log.Logger {
+	return log.LoggerFunc(func(keyvals ...interface{}) error {
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			fields[fmt.Sprint(keyvals[i])] = keyvals[i+1]
+		}
+		return nil
+	})
+}
+
+func serveLoggingRequest(options ...LoggingOption) map[string]interface{} {
+	fields := map[string]interface{}{}
+	h := MakeHttpTransportLoggingMiddleware(captureLogger(fields), options...)(newAccessLogMux())
+
+	req := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+	req.Header.Set("User-Agent", testUserAgent)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("Signature", "abc")
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("Accept", "*/*")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	return fields
+}
+
+func TestTransportLoggingRedaction(t *testing.T) {
+	fields := serveLoggingRequest(LoggingRedactHeaders("x-tenant"))
+	assert.Equal(t, "request completed", fields["event"])
+	assert.Equal(t, "/users/{id}", fields["route"])
+	assert.NotContains(t, fields, "uri")
+	assert.Equal(t, http.StatusOK, fields["status"])
+	assert.Equal(t, "Chrome", fields["user-agent"].(string)[:6])
+
+	headers := fields["headers"].(http.Header)
+	assert.Equal(t, RedactedHeaderValue, headers.Get("Authorization"))
+	assert.Equal(t, RedactedHeaderValue, headers.Get("Cookie"))
+	assert.Equal(t, RedactedHeaderValue, headers.Get("Signature"))
+	assert.Equal(t, RedactedHeaderValue, headers.Get("X-Tenant"))
+	assert.Equal(t, "*/*", headers.Get("Accept"))
+
+	fields = serveLoggingRequest(LoggingAllowHeaders("Accept", "Authorization"))
+	headers = fields["headers"].(http.Header)
+	assert.Equal(t, http.Header{
+		"Accept":        {"*/*"},
+		"Authorization": {RedactedHeaderValue},
+	}, headers)
+}
+
+func TestUserAgentParserCache(t *testing.T) {
+	p := NewUserAgentParser(2)
+
+	c := p.Parse(testUserAgent)
+	assert.Equal(t, "Chrome", c.UserAgent.Family)
+	assert.True(t, c == p.Parse(testUserAgent))
+
+	p.Parse("curl/8.0")
+	p.Parse(testUserAgent)
+	p.Parse("Wget/1.21")
+	assert.Equal(t, 2, p.Len())
+
+	// curl was the least recently used
+	_, cached := p.items["curl/8.0"]
+	assert.False(t, cached)
+	_, cached = p.items[testUserAgent]
+	assert.True(t, cached)
+}
+
+func BenchmarkUserAgentParse(b *testing.B) {
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			uaparser.NewFromSaved().Parse(testUserAgent)
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		p := NewUserAgentParser(0)
+		for i := 0; i < b.N; i++ {
+			p.Parse(testUserAgent)
+		}
+	})
+}
+
+func BenchmarkTransportLoggingMiddleware(b *testing.B) {
+	logger := log.LoggerFunc(func(...interface{}) error { return nil })
+	h := MakeHttpTransportLoggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+	req.Header.Set("User-Agent", testUserAgent)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
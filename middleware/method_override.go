@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+// MethodOverrideFormField is the form field read by the method override
+// middleware when the X-HTTP-Method-Override header is absent.
+const MethodOverrideFormField = "_method"
+
+// MakeHttpMethodOverrideMiddleware returns a middleware letting POST requests
+// ask to be served as another method, through the X-HTTP-Method-Override
+// header or a _method field of a urlencoded form. Only the methods in allowed
+// are accepted, PUT, PATCH and DELETE when none is given; other overrides are
+// ignored. Reading the form field parses the body into r.PostForm.
+//
+// The method has to be rewritten before the route is looked up, so the
+// middleware is meant for Router.UsePreRouting.
+func MakeHttpMethodOverrideMiddleware(allowed ...string) func(http.Handler) http.Handler {
+	if len(allowed) == 0 {
+		allowed = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, m := range allowed {
+		allowedSet[strings.ToUpper(m)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			method := r.Header.Get(gohttp.HeaderXHTTPMethodOverride)
+			if method == "" {
+				mediaType, _, _ := mime.ParseMediaType(r.Header.Get(gohttp.HeaderContentType))
+				if mediaType == gohttp.HttpContentTypeUrlFormEncoded && r.ParseForm() == nil {
+					method = r.PostForm.Get(MethodOverrideFormField)
+				}
+			}
+
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if allowedSet[method] {
+				r2 := *r
+				r2.Method = method
+				r = &r2
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
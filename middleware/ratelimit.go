@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+	route "github.com/likearthian/go-http/router/v2"
+)
+
+// Rate is the number of requests allowed per period. Burst is the number of
+// requests that may be made at once, Limit when zero.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// PerSecond, PerMinute and PerHour build the common rates.
+func PerSecond(limit int) Rate { return Rate{Limit: limit, Period: time.Second} }
+func PerMinute(limit int) Rate { return Rate{Limit: limit, Period: time.Minute} }
+func PerHour(limit int) Rate   { return Rate{Limit: limit, Period: time.Hour} }
+
+// RateLimitKeyFunc returns the key the limit of a request is counted by.
+// Requests for which it returns "" are not limited.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitByIP counts requests by client IP. Behind trustedProxies proxies
+// appending the address of their client to X-Forwarded-For, the address
+// added by the outermost of them is used, trustedProxies entries from the
+// right; entries further left are set by the client and never trusted. With
+// no trusted proxy, or when X-Forwarded-For is missing, the address of the
+// connection is used.
+func RateLimitByIP(trustedProxies int) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		if trustedProxies > 0 {
+			if fwd := r.Header.Values(gohttp.HeaderXForwardedFor); len(fwd) > 0 {
+				addrs := strings.Split(strings.Join(fwd, ","), ",")
+				i := len(addrs) - trustedProxies
+				if i < 0 {
+					i = 0
+				}
+				if addr := strings.TrimSpace(addrs[i]); addr != "" {
+					return addr
+				}
+			}
+		}
+		return remoteHost(r)
+	}
+}
+
+// RateLimitByRealIP counts requests by the client IP of the X-Real-IP
+// header, or the address of the connection when it is missing. Any client
+// can set the header: use it only behind a proxy overwriting it.
+func RateLimitByRealIP() RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		if ip := strings.TrimSpace(r.Header.Get(gohttp.HeaderXRealIP)); ip != "" {
+			return ip
+		}
+		return remoteHost(r)
+	}
+}
+
+// RateLimitByHeader counts requests by the value of header, e.g. an API key.
+func RateLimitByHeader(header string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(header)
+	}
+}
+
+// RateLimitByRoute counts requests by route: the pattern matched by the
+// router, or the request path when the limiter runs before routing.
+func RateLimitByRoute() RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		if pattern := route.RoutePatternFromContext(r.Context()); pattern != "" {
+			return r.Method + " " + pattern
+		}
+		if pattern := gohttp.RoutePatternFromContext(r.Context()); pattern != "" {
+			return r.Method + " " + pattern
+		}
+		return r.Method + " " + r.URL.Path
+	}
+}
+
+// RateLimitResult is the outcome of a rate limited request.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is the time until the limit is fully available again.
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when
+	// Allowed.
+	RetryAfter time.Duration
+}
+
+type RateLimitOption func(*rateLimiter)
+
+// RateLimitKey sets how requests are counted, RateLimitByIP(0) by default.
+func RateLimitKey(fn RateLimitKeyFunc) RateLimitOption {
+	return func(l *rateLimiter) {
+		l.key = fn
+	}
+}
+
+// RateLimitWithStore sets the store of the limiter, an in-memory store by
+// default.
+func RateLimitWithStore(store RateLimitStore) RateLimitOption {
+	return func(l *rateLimiter) {
+		l.store = store
+	}
+}
+
+// RateLimitKeyPrefix prefixes the store keys, so that several limiters can
+// share a store.
+func RateLimitKeyPrefix(prefix string) RateLimitOption {
+	return func(l *rateLimiter) {
+		l.prefix = prefix
+	}
+}
+
+type rateLimiter struct {
+	rate   Rate
+	key    RateLimitKeyFunc
+	store  RateLimitStore
+	prefix string
+	now    func() time.Time
+
+	// emission interval and burst tolerance of the GCRA
+	interval  time.Duration
+	tolerance time.Duration
+}
+
+// maxRateLimitAttempts bounds the retries of a contended compare-and-swap.
+const maxRateLimitAttempts = 10
+
+var errRateLimitContention = errors.New("rate limit store contention")
+
+// MakeHttpRateLimiterMiddleware returns a middleware limiting requests to
+// rate per key, with the generic cell rate algorithm: each key is a token
+// bucket refilled continuously. Responses carry the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers; requests over the limit
+// are answered with 429 Too Many Requests, a Retry-After header and a JSON
+// body. When the store fails, requests are let through.
+func MakeHttpRateLimiterMiddleware(rate Rate, options ...RateLimitOption) func(http.Handler) http.Handler {
+	l := newRateLimiter(rate, options...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := l.key(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := l.allow(key)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set(gohttp.HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+			h.Set(gohttp.HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+			h.Set(gohttp.HeaderRateLimitReset, ceilSeconds(res.ResetAfter))
+
+			if !res.Allowed {
+				h.Set(gohttp.HeaderRetryAfter, ceilSeconds(res.RetryAfter))
+				h.Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+				w.WriteHeader(http.StatusTooManyRequests)
+				retryAfter, _ := strconv.Atoi(ceilSeconds(res.RetryAfter))
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"message":     "rate limit exceeded",
+					"retry_after": retryAfter,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newRateLimiter(rate Rate, options ...RateLimitOption) *rateLimiter {
+	if rate.Limit <= 0 || rate.Period <= 0 {
+		panic("rate limit must be positive")
+	}
+	if rate.Burst <= 0 {
+		rate.Burst = rate.Limit
+	}
+
+	l := &rateLimiter{
+		rate:     rate,
+		key:      RateLimitByIP(0),
+		now:      time.Now,
+		interval: rate.Period / time.Duration(rate.Limit),
+	}
+	l.tolerance = l.interval * time.Duration(rate.Burst)
+
+	for _, op := range options {
+		op(l)
+	}
+	if l.store == nil {
+		l.store = NewMemoryRateLimitStore(0, 0)
+	}
+
+	return l
+}
+
+// allow counts a request of key.
+func (l *rateLimiter) allow(key string) (RateLimitResult, error) {
+	key = l.prefix + key
+	res := RateLimitResult{Limit: l.rate.Burst}
+
+	for i := 0; i < maxRateLimitAttempts; i++ {
+		now := l.now()
+
+		stored, exists, err := l.store.Get(key)
+		if err != nil {
+			return res, err
+		}
+		tat := stored
+		if !exists || tat.Before(now) {
+			tat = now
+		}
+
+		newTat := tat.Add(l.interval)
+		allowAt := newTat.Add(-l.tolerance)
+		if now.Before(allowAt) {
+			res.Allowed = false
+			res.Remaining = 0
+			res.RetryAfter = allowAt.Sub(now)
+			res.ResetAfter = tat.Sub(now)
+			return res, nil
+		}
+
+		ttl := newTat.Sub(now)
+		var swapped bool
+		if exists {
+			swapped, err = l.store.CompareAndSwap(key, stored, newTat, ttl)
+		} else {
+			swapped, err = l.store.SetIfNotExists(key, newTat, ttl)
+		}
+		if err != nil {
+			return res, err
+		}
+		if !swapped {
+			continue
+		}
+
+		res.Allowed = true
+		res.Remaining = int((l.tolerance - ttl) / l.interval)
+		res.ResetAfter = ttl
+		return res, nil
+	}
+
+	return res, errRateLimitContention
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
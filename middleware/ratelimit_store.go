@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// RateLimitStore keeps the theoretical arrival time (TAT) of each rate
+// limited key. Implementations must be safe for concurrent use; a store
+// shared by several instances, e.g. backed by Redis, makes them share the
+// limits.
+type RateLimitStore interface {
+	// Get returns the TAT of key, ok being false when there is none.
+	Get(key string) (tat time.Time, ok bool, err error)
+	// SetIfNotExists stores the TAT of key unless one exists, and reports
+	// whether it did.
+	SetIfNotExists(key string, tat time.Time, ttl time.Duration) (bool, error)
+	// CompareAndSwap replaces the TAT of key when it is still old, and
+	// reports whether it did.
+	CompareAndSwap(key string, old, tat time.Time, ttl time.Duration) (bool, error)
+}
+
+const (
+	defaultRateLimitShards   = 64
+	defaultRateLimitCapacity = 1 << 16
+)
+
+// MemoryRateLimitStore is an in-memory RateLimitStore split into shards, each
+// with its own lock. Entries expire with their TTL; when a shard is over
+// capacity, expired entries are evicted first, then the ones closest to
+// expiring.
+type MemoryRateLimitStore struct {
+	shards   []*rateLimitShard
+	capacity int
+	now      func() time.Time
+}
+
+type rateLimitShard struct {
+	mu      sync.Mutex
+	entries map[string]rateLimitEntry
+}
+
+type rateLimitEntry struct {
+	tat     time.Time
+	expires time.Time
+}
+
+// NewMemoryRateLimitStore creates a store of shards shards holding up to
+// capacity keys in total. Zero values select 64 shards and 65536 keys.
+func NewMemoryRateLimitStore(shards, capacity int) *MemoryRateLimitStore {
+	if shards <= 0 {
+		shards = defaultRateLimitShards
+	}
+	if capacity <= 0 {
+		capacity = defaultRateLimitCapacity
+	}
+
+	s := &MemoryRateLimitStore{
+		shards:   make([]*rateLimitShard, shards),
+		capacity: (capacity + shards - 1) / shards,
+		now:      time.Now,
+	}
+	for i := range s.shards {
+		s.shards[i] = &rateLimitShard{entries: map[string]rateLimitEntry{}}
+	}
+	return s
+}
+
+func (s *MemoryRateLimitStore) shard(key string) *rateLimitShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+func (s *MemoryRateLimitStore) Get(key string) (time.Time, bool, error) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	e, ok := sh.entries[key]
+	if !ok || !e.expires.After(s.now()) {
+		return time.Time{}, false, nil
+	}
+	return e.tat, true, nil
+}
+
+func (s *MemoryRateLimitStore) SetIfNotExists(key string, tat time.Time, ttl time.Duration) (bool, error) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	now := s.now()
+	if e, ok := sh.entries[key]; ok && e.expires.After(now) {
+		return false, nil
+	}
+
+	s.set(sh, key, tat, now.Add(ttl))
+	return true, nil
+}
+
+func (s *MemoryRateLimitStore) CompareAndSwap(key string, old, tat time.Time, ttl time.Duration) (bool, error) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	now := s.now()
+	e, ok := sh.entries[key]
+	if !ok || !e.expires.After(now) || !e.tat.Equal(old) {
+		return false, nil
+	}
+
+	s.set(sh, key, tat, now.Add(ttl))
+	return true, nil
+}
+
+// Len returns the number of keys held, including expired ones not evicted
+// yet.
+func (s *MemoryRateLimitStore) Len() int {
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		n += len(sh.entries)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+func (s *MemoryRateLimitStore) set(sh *rateLimitShard, key string, tat, expires time.Time) {
+	if _, ok := sh.entries[key]; !ok && len(sh.entries) >= s.capacity {
+		s.evict(sh)
+	}
+	sh.entries[key] = rateLimitEntry{tat: tat, expires: expires}
+}
+
+// evict makes room in a full shard.
+func (s *MemoryRateLimitStore) evict(sh *rateLimitShard) {
+	now := s.now()
+	for k, e := range sh.entries {
+		if !e.expires.After(now) {
+			delete(sh.entries, k)
+		}
+	}
+	if len(sh.entries) < s.capacity {
+		return
+	}
+
+	var oldest string
+	var oldestExpires time.Time
+	for k, e := range sh.entries {
+		if oldest == "" || e.expires.Before(oldestExpires) {
+			oldest, oldestExpires = k, e.expires
+		}
+	}
+	delete(sh.entries, oldest)
+}
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/likearthian/go-http/router"
+	"github.com/tj/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestRateLimiterGCRA(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	store := NewMemoryRateLimitStore(4, 16)
+	store.now = clock.Now
+
+	l := newRateLimiter(Rate{Limit: 10, Period: time.Second, Burst: 3}, RateLimitWithStore(store))
+	l.now = clock.Now
+
+	for i := 2; i >= 0; i-- {
+		res, err := l.allow("k")
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := l.allow("k")
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 100*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, 300*time.Millisecond, res.ResetAfter)
+
+	// other keys have their own bucket
+	res, _ = l.allow("other")
+	assert.True(t, res.Allowed)
+
+	// one token is back after the emission interval
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	res, _ = l.allow("k")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	res, _ = l.allow("k")
+	assert.False(t, res.Allowed)
+
+	// the bucket is full again once reset, and the key expired
+	clock.now = clock.now.Add(time.Second)
+	_, ok, _ := store.Get("k")
+	assert.False(t, ok)
+	res, _ = l.allow("k")
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func TestMemoryRateLimitStoreEviction(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	store := NewMemoryRateLimitStore(1, 2)
+	store.now = clock.Now
+
+	tat := clock.now
+	ok, _ := store.SetIfNotExists("a", tat, time.Second)
+	assert.True(t, ok)
+	ok, _ = store.SetIfNotExists("b", tat, 2*time.Second)
+	assert.True(t, ok)
+	ok, _ = store.SetIfNotExists("a", tat, time.Second)
+	assert.False(t, ok)
+
+	// the entry closest to expiring makes room
+	ok, _ = store.SetIfNotExists("c", tat, 3*time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, 2, store.Len())
+	_, ok, _ = store.Get("a")
+	assert.False(t, ok)
+
+	ok, _ = store.CompareAndSwap("b", tat.Add(time.Second), tat, time.Second)
+	assert.False(t, ok)
+	ok, _ = store.CompareAndSwap("b", tat, tat.Add(time.Second), time.Second)
+	assert.True(t, ok)
+
+	// expired entries are evicted first
+	clock.now = clock.now.Add(5 * time.Second)
+	ok, _ = store.SetIfNotExists("d", tat, time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	h := MakeHttpRateLimiterMiddleware(Rate{Limit: 2, Period: time.Hour}, RateLimitKey(RateLimitByHeader("X-API-Key")))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("abc")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(gohttp.HeaderRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(gohttp.HeaderRateLimitRemaining))
+	assert.Equal(t, "1800", rec.Header().Get(gohttp.HeaderRateLimitReset))
+
+	assert.Equal(t, http.StatusOK, serve("abc").Code)
+
+	rec = serve("abc")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(gohttp.HeaderRateLimitRemaining))
+	assert.Equal(t, "1800", rec.Header().Get(gohttp.HeaderRetryAfter))
+	assert.Equal(t, gohttp.HttpContentTypeJson, rec.Header().Get(gohttp.HeaderContentType))
+
+	var body struct {
+		Message    string `json:"message"`
+		RetryAfter int    `json:"retry_after"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "rate limit exceeded", body.Message)
+	assert.Equal(t, 1800, body.RetryAfter)
+
+	// requests without a key are not limited
+	for i := 0; i < 3; i++ {
+		rec = serve("")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get(gohttp.HeaderRateLimitLimit))
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	l := newRateLimiter(Rate{Limit: 100, Period: time.Hour})
+
+	var mu sync.Mutex
+	allowed := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				res, err := l.allow("shared")
+				if err == nil && res.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 100, allowed, strconv.Itoa(allowed))
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:4321"
+	req.Header.Add(gohttp.HeaderXForwardedFor, "1.1.1.1, 203.0.113.7")
+	req.Header.Add(gohttp.HeaderXForwardedFor, "10.0.0.1")
+
+	assert.Equal(t, "10.0.0.2", RateLimitByIP(0)(req))
+	assert.Equal(t, "10.0.0.1", RateLimitByIP(1)(req))
+	assert.Equal(t, "203.0.113.7", RateLimitByIP(2)(req))
+	// a chain shorter than the trusted proxies falls back to its first entry
+	assert.Equal(t, "1.1.1.1", RateLimitByIP(5)(req))
+
+	// X-Real-IP is trusted only when asked for
+	req.Header.Del(gohttp.HeaderXForwardedFor)
+	req.Header.Set(gohttp.HeaderXRealIP, "203.0.113.8")
+	assert.Equal(t, "10.0.0.2", RateLimitByIP(1)(req))
+	assert.Equal(t, "203.0.113.8", RateLimitByRealIP()(req))
+
+	req.Header.Del(gohttp.HeaderXRealIP)
+	assert.Equal(t, "10.0.0.2", RateLimitByRealIP()(req))
+}
+
+func TestRateLimitByRoute(t *testing.T) {
+	rtr := router.NewRouter()
+	rtr.Use(router.MiddlewareFunc(MakeHttpRateLimiterMiddleware(PerHour(2), RateLimitKey(RateLimitByRoute()))))
+	rtr.Methods(http.MethodGet).Handler("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rtr.Methods(http.MethodGet).Handler("/teams/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(path string) int {
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/users/1"))
+	assert.Equal(t, http.StatusOK, serve("/users/2"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("/users/3"))
+	assert.Equal(t, http.StatusOK, serve("/teams/1"))
+}
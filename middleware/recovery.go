@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	gohttp "github.com/likearthian/go-http"
+	log "github.com/likearthian/go-logger"
+	"github.com/likearthian/go-logger/level"
+)
+
+// RecoveryHookFunc is called with every recovered panic, e.g. to report it
+// to an error tracker.
+type RecoveryHookFunc func(r *http.Request, recovered interface{}, stack []byte)
+
+type recoveryConfig struct {
+	hooks []RecoveryHookFunc
+}
+
+type RecoveryOption func(*recoveryConfig)
+
+// RecoveryHook adds a hook called with the recovered panics, after they are
+// logged and before the response is written.
+func RecoveryHook(hook RecoveryHookFunc) RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.hooks = append(c.hooks, hook)
+	}
+}
+
+// MakeHttpRecoveryMiddleware returns a middleware recovering the panics of
+// the handlers. The panic is logged with its stack trace, the request ID and
+// the route, and the client gets a JSON 500 with the request ID only. When
+// the handler already wrote the header, the response cannot be replaced and
+// the connection is aborted instead. http.ErrAbortHandler panics are not
+// recovered, so they keep aborting the response silently.
+func MakeHttpRecoveryMiddleware(logger log.Logger, options ...RecoveryOption) func(http.Handler) http.Handler {
+	cfg := &recoveryConfig{}
+	for _, op := range options {
+		op(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(gohttp.WithRoutePatternRecorder(r.Context()))
+			rw := WrapResponseWriter(w)
+
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				stack := debug.Stack()
+				reqid, ok := gohttp.RequestIDFromContext(r.Context())
+				if !ok {
+					reqid = r.Header.Get(gohttp.HeaderXRequestID)
+				}
+
+				_ = level.Error(logger).Log(
+					"event", "panic recovered",
+					"panic", fmt.Sprint(rec),
+					"request-id", reqid,
+					"method", r.Method,
+					"route", gohttp.RecordedRoutePattern(r.Context()),
+					"uri", r.RequestURI,
+					"header-written", rw.Status() != 0,
+					"stack", string(stack),
+				)
+
+				for _, hook := range cfg.hooks {
+					hook(r, rec, stack)
+				}
+
+				if rw.Status() != 0 {
+					panic(http.ErrAbortHandler)
+				}
+
+				body := map[string]string{"message": http.StatusText(http.StatusInternalServerError)}
+				if reqid != "" {
+					body["request_id"] = reqid
+				}
+				// headers describing the body the handler meant to write
+				h := rw.Header()
+				h.Del(gohttp.HeaderContentLength)
+				h.Del(gohttp.HeaderContentEncoding)
+				h.Del(gohttp.HeaderContentDisposition)
+				h.Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+				rw.WriteHeader(http.StatusInternalServerError)
+				_ = json.NewEncoder(rw).Encode(body)
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	route "github.com/likearthian/go-http/router/v2"
+	"github.com/tj/assert"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	fields := map[string]interface{}{}
+	var hooked interface{}
+	recovery := MakeHttpRecoveryMiddleware(captureLogger(fields), RecoveryHook(func(r *http.Request, rec interface{}, stack []byte) {
+		hooked = rec
+	}))
+
+	mx := route.NewRouter()
+	mx.Methods(http.MethodGet).Handler("/boom/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(gohttp.HeaderContentLength, "42")
+		panic("db password is hunter2")
+	}))
+	mx.Methods(http.MethodGet).Handler("/late", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("too late")
+	}))
+	mx.Methods(http.MethodGet).Handler("/abort", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	h := MakeHttpRequestIDMiddleware()(recovery(mx))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boom/1", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, gohttp.HttpContentTypeJson, rec.Header().Get(gohttp.HeaderContentType))
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderContentLength))
+	assert.NotContains(t, rec.Body.String(), "hunter2")
+
+	var body map[string]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	reqid := rec.Header().Get(gohttp.HeaderXRequestID)
+	assert.Equal(t, map[string]string{"message": "Internal Server Error", "request_id": reqid}, body)
+
+	assert.Equal(t, "panic recovered", fields["event"])
+	assert.Equal(t, "db password is hunter2", fields["panic"])
+	assert.Equal(t, reqid, fields["request-id"])
+	assert.Equal(t, "/boom/{id}", fields["route"])
+	assert.True(t, strings.Contains(fields["stack"].(string), "runtime/debug.Stack"))
+	assert.Equal(t, "db password is hunter2", hooked)
+
+	// the response is already on its way, the connection is aborted
+	rec = httptest.NewRecorder()
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/late", nil))
+	})
+	assert.Equal(t, true, fields["header-written"])
+	assert.Equal(t, "too late", hooked)
+
+	hooked = nil
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	})
+	assert.Nil(t, hooked)
+}
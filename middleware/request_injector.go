@@ -1,24 +1,160 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
 	"net/http"
+	"time"
 
+	gohttp "github.com/likearthian/go-http"
 	"github.com/rs/xid"
 )
 
-func HttpRequestIDInjectorMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		reqid := r.Header.Get("X-Request-Id")
+// DefaultRequestIDMaxLength is the maximum length of an incoming request ID
+// accepted by default.
+const DefaultRequestIDMaxLength = 128
+
+// RequestIDGenerator returns a new request ID.
+type RequestIDGenerator func() string
+
+// XIDGenerator generates 20 character xids, sortable by creation time.
+func XIDGenerator() string {
+	return xid.New().String()
+}
+
+// UUIDv4Generator generates random RFC 4122 UUIDs.
+func UUIDv4Generator() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
 
-		if reqid == "" {
-			reqid = xid.New().String()
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator generates 26 character ULIDs: a millisecond timestamp
+// followed by 80 random bits, sortable by creation time.
+func ULIDGenerator() string {
+	var b [16]byte
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(b[:6], ms[2:])
+	_, _ = rand.Read(b[6:])
+
+	// 26 characters of 5 bits encode 130 bits, the first 2 being zero
+	var s [26]byte
+	for i := range s {
+		var v byte
+		for j := 0; j < 5; j++ {
+			v <<= 1
+			if p := i*5 + j - 2; p >= 0 && b[p/8]&(0x80>>uint(p%8)) != 0 {
+				v |= 1
+			}
 		}
+		s[i] = crockfordAlphabet[v]
+	}
+	return string(s[:])
+}
+
+type requestIDConfig struct {
+	header    string
+	generate  RequestIDGenerator
+	maxLength int
+	validate  func(id string) bool
+}
+
+type RequestIDOption func(*requestIDConfig)
+
+// RequestIDHeader sets the header the ID is read from and echoed in,
+// X-Request-ID by default.
+func RequestIDHeader(header string) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.header = header
+	}
+}
+
+// RequestIDWithGenerator sets the generator of the IDs of requests coming
+// without a valid one, XIDGenerator by default.
+func RequestIDWithGenerator(generate RequestIDGenerator) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.generate = generate
+	}
+}
+
+// RequestIDMaxLength sets the maximum length of the incoming IDs,
+// DefaultRequestIDMaxLength by default.
+func RequestIDMaxLength(n int) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.maxLength = n
+	}
+}
+
+// RequestIDValidator replaces the check of the charset of the incoming IDs,
+// which accepts letters, digits and "-_.:".
+func RequestIDValidator(validate func(id string) bool) RequestIDOption {
+	return func(c *requestIDConfig) {
+		c.validate = validate
+	}
+}
 
-		r.Header.Set("X-Request-Id", reqid)
+// MakeHttpRequestIDMiddleware returns a middleware giving every request an
+// ID: the one sent by the client when it is valid, a generated one
+// otherwise. The ID is set in the request and response headers and in the
+// context, where it is read by ReqIDFromContext and forwarded by the client
+// package.
+func MakeHttpRequestIDMiddleware(options ...RequestIDOption) func(http.Handler) http.Handler {
+	cfg := &requestIDConfig{
+		header:    gohttp.HeaderXRequestID,
+		generate:  XIDGenerator,
+		maxLength: DefaultRequestIDMaxLength,
+		validate:  validRequestIDChars,
+	}
+	for _, op := range options {
+		op(cfg)
+	}
 
-		// inject header
-		// w.Header().Set("Access-Control-Allow-Headers", "Authorization,Origin,Accept,datetime,signature")
-		// w.Header().Set("Content-Type", "application/json")
-		next.ServeHTTP(w, r)
-	})
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqid := r.Header.Get(cfg.header)
+			if reqid == "" || len(reqid) > cfg.maxLength || !cfg.validate(reqid) {
+				reqid = cfg.generate()
+			}
+
+			r.Header.Set(cfg.header, reqid)
+			w.Header().Set(cfg.header, reqid)
+			next.ServeHTTP(w, r.WithContext(gohttp.ContextWithRequestID(r.Context(), reqid)))
+		})
+	}
+}
+
+func validRequestIDChars(id string) bool {
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// HttpRequestIDInjectorMiddleware is MakeHttpRequestIDMiddleware with the
+// default options.
+func HttpRequestIDInjectorMiddleware(next http.Handler) http.Handler {
+	return MakeHttpRequestIDMiddleware()(next)
 }
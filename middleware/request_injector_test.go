@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/likearthian/go-http/router"
+	"github.com/tj/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	serve := func(incoming string, options ...RequestIDOption) (string, string) {
+		var fromContext string
+		h := MakeHttpRequestIDMiddleware(options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fromContext, _ = router.ReqIDFromContext(r.Context())
+			assert.Equal(t, fromContext, r.Header.Get(gohttp.HeaderXRequestID))
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if incoming != "" {
+			req.Header.Set(gohttp.HeaderXRequestID, incoming)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Header().Get(gohttp.HeaderXRequestID), fromContext
+	}
+
+	echoed, ctxID := serve("client-id_1.2:3")
+	assert.Equal(t, "client-id_1.2:3", echoed)
+	assert.Equal(t, echoed, ctxID)
+
+	echoed, ctxID = serve("")
+	assert.Len(t, echoed, 20)
+	assert.Equal(t, echoed, ctxID)
+
+	echoed, _ = serve("bad id\r\n")
+	assert.NotEqual(t, "bad id\r\n", echoed)
+	echoed, _ = serve(strings.Repeat("a", DefaultRequestIDMaxLength+1))
+	assert.Len(t, echoed, 20)
+	echoed, _ = serve("abcdef", RequestIDMaxLength(4))
+	assert.NotEqual(t, "abcdef", echoed)
+
+	echoed, _ = serve("", RequestIDWithGenerator(UUIDv4Generator))
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), echoed)
+
+	echoed, _ = serve("", RequestIDWithGenerator(ULIDGenerator))
+	assert.Regexp(t, regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`), echoed)
+}
+
+func TestULIDGeneratorSortable(t *testing.T) {
+	a := ULIDGenerator()
+	for i := 0; i < 3; i++ {
+		b := ULIDGenerator()
+		// ids of the same millisecond share the timestamp
+		assert.True(t, a[:10] <= b[:10])
+		a = b
+	}
+}
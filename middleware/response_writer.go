@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ResponseWriter is an http.ResponseWriter recording the response written
+// through it.
+type ResponseWriter interface {
+	http.ResponseWriter
+	// Status returns the status code written, zero until the header is
+	// written.
+	Status() int
+	// BytesWritten returns the number of body bytes written.
+	BytesWritten() int64
+	// TimeToFirstByte returns the time from the wrapping of the writer to
+	// the writing of the header, zero until then.
+	TimeToFirstByte() time.Duration
+	// Unwrap returns the wrapped http.ResponseWriter.
+	Unwrap() http.ResponseWriter
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	start  time.Time
+	status int
+	bytes  int64
+	ttfb   time.Duration
+}
+
+// WrapResponseWriter wraps w into a ResponseWriter. The result implements
+// http.Flusher, http.Hijacker and http.Pusher when w does.
+func WrapResponseWriter(w http.ResponseWriter) ResponseWriter {
+	rw := &responseWriter{ResponseWriter: w, start: time.Now()}
+
+	f, isFlusher := w.(http.Flusher)
+	h, isHijacker := w.(http.Hijacker)
+	p, isPusher := w.(http.Pusher)
+	if isFlusher {
+		f = flusher{rw}
+	}
+	if isHijacker {
+		h = hijacker{rw}
+	}
+	if isPusher {
+		p = pusher{rw}
+	}
+
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{rw, f, h, p}
+	case isFlusher && isHijacker:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+		}{rw, f, h}
+	case isFlusher && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Pusher
+		}{rw, f, p}
+	case isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Hijacker
+			http.Pusher
+		}{rw, h, p}
+	case isFlusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+		}{rw, f}
+	case isHijacker:
+		return struct {
+			*responseWriter
+			http.Hijacker
+		}{rw, h}
+	case isPusher:
+		return struct {
+			*responseWriter
+			http.Pusher
+		}{rw, p}
+	}
+	return rw
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+		rw.ttfb = time.Since(rw.start)
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+func (rw *responseWriter) Status() int {
+	return rw.status
+}
+
+func (rw *responseWriter) BytesWritten() int64 {
+	return rw.bytes
+}
+
+func (rw *responseWriter) TimeToFirstByte() time.Duration {
+	return rw.ttfb
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+type flusher struct{ rw *responseWriter }
+
+func (f flusher) Flush() {
+	if f.rw.status == 0 {
+		f.rw.WriteHeader(http.StatusOK)
+	}
+	f.rw.ResponseWriter.(http.Flusher).Flush()
+}
+
+type hijacker struct{ rw *responseWriter }
+
+// Hijack records the connection as switching protocols, since the response
+// is no longer written through the writer.
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := h.rw.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && h.rw.status == 0 {
+		h.rw.status = http.StatusSwitchingProtocols
+		h.rw.ttfb = time.Since(h.rw.start)
+	}
+	return conn, buf, err
+}
+
+type pusher struct{ rw *responseWriter }
+
+func (p pusher) Push(target string, opts *http.PushOptions) error {
+	return p.rw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
@@ -0,0 +1,535 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// HeaderSignatureDatetime and HeaderSignature are the headers of the
+	// request signature scheme, as captured by PopulateRequestContextFromHttp
+	// of the router package.
+	HeaderSignatureDatetime = "datetime"
+	HeaderSignature         = "signature"
+
+	DefaultSignatureClientIDHeader = "X-Client-Id"
+	DefaultSignatureNonceHeader    = "X-Nonce"
+	DefaultSignatureMaxSkew        = 5 * time.Minute
+	// DefaultSignatureMaxBodySize is the maximum size of a body read to
+	// verify its signature.
+	DefaultSignatureMaxBodySize = 10 << 20
+)
+
+// SigningKeyResolver finds the HMAC key of a client. It returns
+// ErrInvalidCredentials for unknown clients.
+type SigningKeyResolver interface {
+	SigningKey(ctx context.Context, clientID string) ([]byte, error)
+}
+
+// SigningKeyResolverFunc is a function implementing SigningKeyResolver.
+type SigningKeyResolverFunc func(ctx context.Context, clientID string) ([]byte, error)
+
+func (f SigningKeyResolverFunc) SigningKey(ctx context.Context, clientID string) ([]byte, error) {
+	return f(ctx, clientID)
+}
+
+// StaticSigningKeys resolves the keys from keys, mapping client IDs to keys.
+func StaticSigningKeys(keys map[string][]byte) SigningKeyResolver {
+	return SigningKeyResolverFunc(func(ctx context.Context, clientID string) ([]byte, error) {
+		key, ok := keys[clientID]
+		if !ok {
+			return nil, ErrInvalidCredentials
+		}
+		return key, nil
+	})
+}
+
+// NonceStore remembers the nonces of signed requests, to reject replays.
+type NonceStore interface {
+	// Remember records nonce for ttl, and reports false when it is already
+	// recorded.
+	Remember(nonce string, ttl time.Duration) (bool, error)
+}
+
+// ErrNonceStoreFull is returned by a MemoryNonceStore holding as many
+// unexpired nonces as its capacity. Live nonces are never evicted, so a full
+// store fails the requests rather than accepting replays.
+var ErrNonceStoreFull = errors.New("nonce store full")
+
+const (
+	defaultNonceStoreShards   = 64
+	defaultNonceStoreCapacity = 1 << 16
+	// how often a full store looks for expired nonces in all its shards
+	nonceStoreSweepInterval = time.Second
+)
+
+// MemoryNonceStore is an in-memory NonceStore split into shards, each with
+// its own lock. Its capacity holds across the shards; expired nonces are
+// dropped when it is full.
+type MemoryNonceStore struct {
+	shards   []*nonceShard
+	capacity int64
+	size     int64 // atomic
+	// lastSweep is the time of the last sweep of all the shards, in unix
+	// nanoseconds
+	lastSweep int64 // atomic
+	now       func() time.Time
+}
+
+type nonceShard struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+// NewMemoryNonceStore creates a store holding up to capacity nonces, 65536
+// when zero.
+func NewMemoryNonceStore(capacity int) *MemoryNonceStore {
+	if capacity <= 0 {
+		capacity = defaultNonceStoreCapacity
+	}
+	shards := defaultNonceStoreShards
+	if capacity < shards {
+		shards = capacity
+	}
+
+	s := &MemoryNonceStore{
+		shards:   make([]*nonceShard, shards),
+		capacity: int64(capacity),
+		now:      time.Now,
+	}
+	for i := range s.shards {
+		s.shards[i] = &nonceShard{expires: map[string]time.Time{}}
+	}
+	return s
+}
+
+func (s *MemoryNonceStore) Remember(nonce string, ttl time.Duration) (bool, error) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(nonce))
+	sh := s.shards[h.Sum32()%uint32(len(s.shards))]
+	now := s.now()
+
+	sh.mu.Lock()
+	fresh, err := s.remember(sh, nonce, now, ttl)
+	if err == ErrNonceStoreFull {
+		s.dropExpired(sh, now)
+		fresh, err = s.remember(sh, nonce, now, ttl)
+	}
+	sh.mu.Unlock()
+	if err != ErrNonceStoreFull || !s.startSweep(now) {
+		return fresh, err
+	}
+
+	// the shards are locked one at a time, never along with another one
+	for _, o := range s.shards {
+		o.mu.Lock()
+		s.dropExpired(o, now)
+		o.mu.Unlock()
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return s.remember(sh, nonce, now, ttl)
+}
+
+// Len returns the number of nonces held, including expired ones not dropped
+// yet.
+func (s *MemoryNonceStore) Len() int {
+	return int(atomic.LoadInt64(&s.size))
+}
+
+// remember records nonce in sh, which lock is held.
+func (s *MemoryNonceStore) remember(sh *nonceShard, nonce string, now time.Time, ttl time.Duration) (bool, error) {
+	expires, ok := sh.expires[nonce]
+	if ok && expires.After(now) {
+		return false, nil
+	}
+	if !ok {
+		if atomic.AddInt64(&s.size, 1) > s.capacity {
+			atomic.AddInt64(&s.size, -1)
+			return false, ErrNonceStoreFull
+		}
+	}
+
+	sh.expires[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// dropExpired drops the expired nonces of sh, which lock is held.
+func (s *MemoryNonceStore) dropExpired(sh *nonceShard, now time.Time) {
+	for k, expires := range sh.expires {
+		if !expires.After(now) {
+			delete(sh.expires, k)
+			atomic.AddInt64(&s.size, -1)
+		}
+	}
+}
+
+// startSweep reports whether the caller is to sweep all the shards, which
+// happens at most once per nonceStoreSweepInterval.
+func (s *MemoryNonceStore) startSweep(now time.Time) bool {
+	last := atomic.LoadInt64(&s.lastSweep)
+	if last != 0 && now.Sub(time.Unix(0, last)) < nonceStoreSweepInterval {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&s.lastSweep, last, now.UnixNano())
+}
+
+type signatureConfig struct {
+	clientIDHeader string
+	nonceHeader    string
+	realm          string
+	signedHeaders  []string
+	maxSkew        time.Duration
+	maxBodySize    int64
+	nonces         NonceStore
+	noNonce        bool
+	now            func() time.Time
+}
+
+type SignatureOption func(*signatureConfig)
+
+// SignatureClientIDHeader sets the header naming the client,
+// X-Client-Id by default.
+func SignatureClientIDHeader(header string) SignatureOption {
+	return func(c *signatureConfig) {
+		c.clientIDHeader = header
+	}
+}
+
+// SignatureRealm sets the realm of the Signature challenge answering the
+// requests failing verification.
+func SignatureRealm(realm string) SignatureOption {
+	return func(c *signatureConfig) {
+		c.realm = realm
+	}
+}
+
+// SignatureNonceHeader sets the header carrying the nonce, X-Nonce by
+// default.
+func SignatureNonceHeader(header string) SignatureOption {
+	return func(c *signatureConfig) {
+		c.nonceHeader = header
+	}
+}
+
+// SignedHeaders sets the headers covered by the signature, in order,
+// Content-Type by default.
+func SignedHeaders(headers ...string) SignatureOption {
+	return func(c *signatureConfig) {
+		c.signedHeaders = headers
+	}
+}
+
+// SignatureMaxSkew sets how far the datetime of a request may be from the
+// clock of the server, 5 minutes by default.
+func SignatureMaxSkew(skew time.Duration) SignatureOption {
+	return func(c *signatureConfig) {
+		c.maxSkew = skew
+	}
+}
+
+// SignatureMaxBodySize sets the maximum size of the body of a signed
+// request, DefaultSignatureMaxBodySize by default. Larger requests are
+// answered with 413 Request Entity Too Large.
+func SignatureMaxBodySize(n int64) SignatureOption {
+	return func(c *signatureConfig) {
+		c.maxBodySize = n
+	}
+}
+
+// SignatureNonceStore sets the store of the nonces, an in-memory store by
+// default. A nil store disables the replay protection and the nonce header.
+func SignatureNonceStore(store NonceStore) SignatureOption {
+	return func(c *signatureConfig) {
+		c.nonces = store
+		c.noNonce = store == nil
+	}
+}
+
+func newSignatureConfig(options ...SignatureOption) *signatureConfig {
+	cfg := &signatureConfig{
+		clientIDHeader: DefaultSignatureClientIDHeader,
+		nonceHeader:    DefaultSignatureNonceHeader,
+		signedHeaders:  []string{"Content-Type"},
+		maxSkew:        DefaultSignatureMaxSkew,
+		maxBodySize:    DefaultSignatureMaxBodySize,
+		now:            time.Now,
+	}
+	for _, op := range options {
+		op(cfg)
+	}
+	return cfg
+}
+
+// signatureError is the error of a request failing verification.
+type signatureError string
+
+func (e signatureError) Error() string {
+	return string(e)
+}
+
+func (e signatureError) Unwrap() error {
+	return ErrInvalidCredentials
+}
+
+const (
+	errSignatureMissing signatureError = "missing signature headers"
+	errSignatureSkew    signatureError = "request datetime outside the allowed window"
+	errSignatureInvalid signatureError = "invalid signature"
+	errSignatureReplay  signatureError = "replayed request"
+)
+
+var errSignatureBodyTooLarge = errors.New("request body too large")
+
+// MakeHttpSignatureVerifierMiddleware returns a middleware verifying the
+// HMAC-SHA256 signature of requests, sent in the signature header in hex or
+// base64, with the key of the client named by the client ID header. The
+// signed string is made of, one per line:
+//
+//	the method
+//	the escaped path
+//	the query, its parameters sorted by name and value
+//	name:value of each signed header, lower-cased, in the configured order
+//	the nonce, empty when the replay protection is disabled
+//	the hex SHA-256 of the body
+//	the value of the datetime header
+//
+// The datetime, in RFC 3339 or Unix seconds, must be within the allowed skew
+// of the server clock, and a nonce is accepted once per client. The body is
+// read up to the maximum body size, larger requests being answered with 413.
+// Requests failing verification are answered with 401 and a Signature
+// challenge; the signing client is put in the context as a Principal of
+// scheme Signature.
+func MakeHttpSignatureVerifierMiddleware(keys SigningKeyResolver, options ...SignatureOption) func(http.Handler) http.Handler {
+	cfg := newSignatureConfig(options...)
+	if cfg.nonces == nil && !cfg.noNonce {
+		cfg.nonces = NewMemoryNonceStore(0)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := cfg.verify(r, keys)
+			if errors.Is(err, ErrInvalidCredentials) {
+				// unknown clients get the same answer as bad signatures
+				var sigErr signatureError
+				if !errors.As(err, &sigErr) {
+					sigErr = errSignatureInvalid
+				}
+				unauthorized(w, sigErr.Error(), cfg.challenge(sigErr))
+				return
+			}
+			if errors.Is(err, errSignatureBodyTooLarge) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, "signature verification failed")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// challenge returns the WWW-Authenticate challenge of a request failing
+// with err. The scheme is not registered, the challenge names the headers
+// the signature is expected in.
+func (cfg *signatureConfig) challenge(err signatureError) string {
+	c := "Signature "
+	if cfg.realm != "" {
+		c += "realm=" + quoteAuthParam(cfg.realm) + ", "
+	}
+	headers := []string{HeaderSignatureDatetime, strings.ToLower(cfg.clientIDHeader)}
+	if cfg.nonces != nil {
+		headers = append(headers, strings.ToLower(cfg.nonceHeader))
+	}
+	for _, h := range cfg.signedHeaders {
+		headers = append(headers, strings.ToLower(h))
+	}
+	c += "headers=" + quoteAuthParam(strings.Join(headers, " "))
+	return c + ", error_description=" + quoteAuthParam(string(err))
+}
+
+func (cfg *signatureConfig) verify(r *http.Request, keys SigningKeyResolver) (*Principal, error) {
+	clientID := r.Header.Get(cfg.clientIDHeader)
+	datetime := r.Header.Get(HeaderSignatureDatetime)
+	signature := r.Header.Get(HeaderSignature)
+	var nonce string
+	if cfg.nonces != nil {
+		nonce = r.Header.Get(cfg.nonceHeader)
+	}
+	if clientID == "" || datetime == "" || signature == "" || (cfg.nonces != nil && nonce == "") {
+		return nil, errSignatureMissing
+	}
+
+	t, ok := parseSignatureDatetime(datetime)
+	if !ok {
+		return nil, errSignatureSkew
+	}
+	if skew := cfg.now().Sub(t); skew > cfg.maxSkew || skew < -cfg.maxSkew {
+		return nil, errSignatureSkew
+	}
+
+	sig, ok := decodeSignature(signature)
+	if !ok {
+		return nil, errSignatureInvalid
+	}
+
+	key, err := keys.SigningKey(r.Context(), clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := readBody(r, cfg.maxBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(canonicalRequest(r, body, cfg.signedHeaders, nonce, datetime)))
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return nil, errSignatureInvalid
+	}
+
+	// nonces are checked last, so that invalid requests do not burn them
+	if cfg.nonces != nil {
+		fresh, err := cfg.nonces.Remember(clientID+":"+nonce, 2*cfg.maxSkew)
+		if err != nil {
+			return nil, err
+		}
+		if !fresh {
+			return nil, errSignatureReplay
+		}
+	}
+
+	return &Principal{Subject: clientID, Scheme: "Signature"}, nil
+}
+
+// readBody reads the body of r, up to max bytes when max is positive, and
+// puts it back for the handler.
+func readBody(r *http.Request, max int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	if max > 0 && r.ContentLength > max {
+		return nil, errSignatureBodyTooLarge
+	}
+
+	var body []byte
+	var err error
+	if max > 0 {
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+		if err == nil && int64(len(body)) > max {
+			err = errSignatureBodyTooLarge
+		}
+	} else {
+		body, err = ioutil.ReadAll(r.Body)
+	}
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func parseSignatureDatetime(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), true
+	}
+	return time.Time{}, false
+}
+
+// decodeSignature decodes a hex or base64 signature.
+func decodeSignature(s string) ([]byte, bool) {
+	if len(s) == hex.EncodedLen(sha256.Size) {
+		if b, err := hex.DecodeString(s); err == nil {
+			return b, true
+		}
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+func canonicalRequest(r *http.Request, body []byte, signedHeaders []string, nonce, datetime string) string {
+	var b strings.Builder
+	b.WriteString(r.Method + "\n")
+	b.WriteString(r.URL.EscapedPath() + "\n")
+	b.WriteString(canonicalQuery(r.URL.Query()) + "\n")
+	for _, h := range signedHeaders {
+		b.WriteString(strings.ToLower(h) + ":" + strings.TrimSpace(strings.Join(r.Header.Values(h), ",")) + "\n")
+	}
+	b.WriteString(nonce + "\n")
+	sum := sha256.Sum256(body)
+	b.WriteString(hex.EncodeToString(sum[:]) + "\n")
+	b.WriteString(datetime)
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	pairs := make([]string, 0, len(q))
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// SignRequest signs r for MakeHttpSignatureVerifierMiddleware configured with
+// the same options, as the client clientID owning key. It sets the client
+// ID, datetime, nonce and signature headers; the body is read and put back.
+func SignRequest(r *http.Request, clientID string, key []byte, options ...SignatureOption) error {
+	cfg := newSignatureConfig(options...)
+
+	body, err := readBody(r, 0)
+	if err != nil {
+		return err
+	}
+
+	var nonce string
+	if !cfg.noNonce {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return err
+		}
+		nonce = hex.EncodeToString(b[:])
+		r.Header.Set(cfg.nonceHeader, nonce)
+	}
+
+	datetime := cfg.now().UTC().Format(time.RFC3339)
+	r.Header.Set(cfg.clientIDHeader, clientID)
+	r.Header.Set(HeaderSignatureDatetime, datetime)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(canonicalRequest(r, body, cfg.signedHeaders, nonce, datetime)))
+	r.Header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return nil
+}
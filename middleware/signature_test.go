@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/tj/assert"
+)
+
+func signatureNow(t time.Time) SignatureOption {
+	return func(c *signatureConfig) {
+		c.now = func() time.Time { return t }
+	}
+}
+
+func TestCanonicalRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/orders/a%2Fb?b=2&a=z&a=1&c", nil)
+	req.Header.Set(gohttp.HeaderContentType, " application/json ")
+	bodyHash := sha256.Sum256([]byte(`{"id":1}`))
+
+	assert.Equal(t, strings.Join([]string{
+		"POST",
+		"/orders/a%2Fb",
+		"a=1&a=z&b=2&c=",
+		"content-type:application/json",
+		"nonce-1",
+		hex.EncodeToString(bodyHash[:]),
+		"2023-11-14T22:13:20Z",
+	}, "\n"), canonicalRequest(req, []byte(`{"id":1}`), []string{"Content-Type"}, "nonce-1", "2023-11-14T22:13:20Z"))
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	now := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	key := []byte("partner-secret")
+	keys := StaticSigningKeys(map[string][]byte{"partner": key})
+
+	var body string
+	h := MakeHttpSignatureVerifierMiddleware(keys, signatureNow(now))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFromContext(r.Context())
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		_, _ = w.Write([]byte(p.Scheme + ":" + p.Subject))
+	}))
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/orders?b=2&a=1", strings.NewReader(`{"id":1}`))
+		req.Header.Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+		return req
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	req := newRequest()
+	assert.NoError(t, SignRequest(req, "partner", key, signatureNow(now.Add(-time.Minute))))
+	replay := req.Clone(context.Background())
+	replay.Body = ioutil.NopCloser(strings.NewReader(`{"id":1}`))
+
+	rec := serve(req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Signature:partner", rec.Body.String())
+	assert.Equal(t, `{"id":1}`, body)
+
+	rec = serve(replay)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "{\"message\":\"replayed request\"}\n", rec.Body.String())
+	assert.Equal(t, `Signature headers="datetime x-client-id x-nonce content-type", error_description="replayed request"`,
+		rec.Header().Get(gohttp.HeaderWWWAuthenticate))
+
+	for message, tamper := range map[string]func(r *http.Request){
+		"invalid signature": func(r *http.Request) { r.URL.RawQuery = "a=1&b=3" },
+		"missing signature headers": func(r *http.Request) {
+			r.Header.Del(HeaderSignature)
+		},
+		"request datetime outside the allowed window": func(r *http.Request) {
+			r.Header.Set(HeaderSignatureDatetime, now.Add(-6*time.Minute).Format(time.RFC3339))
+		},
+	} {
+		req := newRequest()
+		assert.NoError(t, SignRequest(req, "partner", key, signatureNow(now)))
+		tamper(req)
+		rec := serve(req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, message)
+		assert.Equal(t, "{\"message\":\""+message+"\"}\n", rec.Body.String())
+	}
+
+	// a tampered body does not burn the nonce
+	req = newRequest()
+	assert.NoError(t, SignRequest(req, "partner", key, signatureNow(now)))
+	genuine := req.Clone(context.Background())
+	genuine.Body = ioutil.NopCloser(strings.NewReader(`{"id":1}`))
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"id":2}`))
+	assert.Equal(t, http.StatusUnauthorized, serve(req).Code)
+	assert.Equal(t, http.StatusOK, serve(genuine).Code)
+
+	req = newRequest()
+	assert.NoError(t, SignRequest(req, "stranger", key, signatureNow(now)))
+	rec = serve(req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "{\"message\":\"invalid signature\"}\n", rec.Body.String())
+}
+
+func TestSignatureVerifierHexWithoutNonce(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	key := []byte("k")
+	keys := SigningKeyResolverFunc(func(ctx context.Context, clientID string) ([]byte, error) {
+		if clientID == "down" {
+			return nil, errors.New("vault unreachable")
+		}
+		return key, nil
+	})
+	h := MakeHttpSignatureVerifierMiddleware(keys, signatureNow(now), SignatureNonceStore(nil), SignedHeaders("X-Tenant"), SignatureRealm("reports"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	sign := func(clientID string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+		req.Header.Set("X-Tenant", "acme")
+		req.Header.Set(DefaultSignatureClientIDHeader, clientID)
+		req.Header.Set(HeaderSignatureDatetime, "1700000030")
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(canonicalRequest(req, nil, []string{"X-Tenant"}, "", "1700000030")))
+		req.Header.Set(HeaderSignature, hex.EncodeToString(mac.Sum(nil)))
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, sign("partner"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// without nonces, the same request is accepted again
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, sign("partner"))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := sign("partner")
+	req.Header.Set("X-Tenant", "other")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Signature realm="reports", headers="datetime x-client-id x-tenant", error_description="invalid signature"`,
+		rec.Header().Get(gohttp.HeaderWWWAuthenticate))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, sign("down"))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestMemoryNonceStoreFull(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	store := NewMemoryNonceStore(64)
+	store.now = clock.Now
+
+	fresh, err := store.Remember("partner:n1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+
+	// the capacity holds across the shards
+	full := 0
+	for i := 0; i < 100; i++ {
+		if _, err := store.Remember("other:"+strconv.Itoa(i), time.Minute); err == ErrNonceStoreFull {
+			full++
+		}
+	}
+	assert.Equal(t, 37, full)
+	assert.Equal(t, 64, store.Len())
+
+	// a full store never forgets a live nonce
+	fresh, err = store.Remember("partner:n1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+
+	// expired nonces make room
+	clock.now = clock.now.Add(time.Minute)
+	fresh, err = store.Remember("partner:n2", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, _ = store.Remember("partner:n1", time.Minute)
+	assert.True(t, fresh)
+}
+
+func TestSignatureVerifierMaxBodySize(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	key := []byte("k")
+	h := MakeHttpSignatureVerifierMiddleware(StaticSigningKeys(map[string][]byte{"partner": key}),
+		signatureNow(now), SignatureMaxBodySize(8))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, body := range []string{"12345678", "123456789"} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		assert.NoError(t, SignRequest(req, "partner", key, signatureNow(now)))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if len(body) <= 8 {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			continue
+		}
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+		// without a declared length, the read is cut at the limit
+		req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		assert.NoError(t, SignRequest(req, "partner", key, signatureNow(now)))
+		req.ContentLength = -1
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	stdlog "log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+	log "github.com/likearthian/go-logger"
+	"github.com/likearthian/go-logger/level"
+)
+
+type timeoutConfig struct {
+	status int
+	logger log.Logger
+}
+
+type TimeoutOption func(*timeoutConfig)
+
+// TimeoutStatus sets the status of the timed out responses, 503 Service
+// Unavailable by default; 504 Gateway Timeout suits proxying handlers.
+func TimeoutStatus(status int) TimeoutOption {
+	return func(c *timeoutConfig) {
+		c.status = status
+	}
+}
+
+// TimeoutLogger sets the logger of the panics raised by handlers after their
+// response timed out, which no recovery middleware can see anymore. They go
+// to the standard logger by default.
+func TimeoutLogger(logger log.Logger) TimeoutOption {
+	return func(c *timeoutConfig) {
+		c.logger = logger
+	}
+}
+
+// MakeHttpTimeoutMiddleware returns a middleware giving handlers timeout to
+// respond. The request context gets the deadline, and when the handler has
+// not returned by then the client gets a JSON error while the writes of the
+// abandoned handler fail with http.ErrHandlerTimeout. The response is
+// buffered until the handler returns, so streaming routes, marked as such in
+// their RouteMetadata, and protocol upgrades are served without timeout. The
+// Timeout of the RouteMetadata overrides timeout for its route.
+func MakeHttpTimeoutMiddleware(timeout time.Duration, options ...TimeoutOption) func(http.Handler) http.Handler {
+	cfg := &timeoutConfig{status: http.StatusServiceUnavailable}
+	for _, op := range options {
+		op(cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := timeout
+			if meta := gohttp.RouteMetadataFromContext(r.Context()); meta != nil {
+				if meta.Streaming {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if meta.Timeout > 0 {
+					d = meta.Timeout
+				}
+			}
+			if d <= 0 || r.Header.Get(gohttp.HeaderUpgrade) != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, h: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan timeoutPanic, 1)
+			go func() {
+				defer func() {
+					if v := recover(); v != nil {
+						p := timeoutPanic{value: v, stack: debug.Stack()}
+						tw.mu.Lock()
+						defer tw.mu.Unlock()
+						if tw.timedOut {
+							cfg.logLatePanic(r, p)
+							return
+						}
+						panicChan <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				// re-raised as is, for the recovery middleware to inspect
+				panic(p.value)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k, vv := range tw.h {
+					dst[k] = vv
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				_, _ = w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				select {
+				case p := <-panicChan:
+					// the handler panicked as the deadline passed
+					cfg.logLatePanic(r, p)
+				default:
+				}
+				if ctx.Err() == context.DeadlineExceeded {
+					writeJSONError(w, cfg.status, fmt.Sprintf("request timed out after %s", d))
+				}
+				// a canceled request has no client left to answer
+			}
+		})
+	}
+}
+
+// logLatePanic logs the panic p of a handler which response timed out.
+func (cfg *timeoutConfig) logLatePanic(r *http.Request, p timeoutPanic) {
+	if p.value == http.ErrAbortHandler {
+		return
+	}
+	if cfg.logger == nil {
+		stdlog.Printf("http: panic serving %s %s after timeout: %v", r.Method, r.RequestURI, p)
+		return
+	}
+	_ = level.Error(cfg.logger).Log(
+		"event", "panic after timeout",
+		"panic", fmt.Sprint(p.value),
+		"method", r.Method,
+		"uri", r.RequestURI,
+		"stack", string(p.stack),
+	)
+}
+
+// timeoutPanic carries the panic of the handler to the serving goroutine,
+// with the stack of the handler for the panics logged after the timeout.
+type timeoutPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p timeoutPanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+// timeoutWriter buffers the response of the handler until it returns.
+type timeoutWriter struct {
+	w  http.ResponseWriter
+	h  http.Header
+	mu sync.Mutex
+
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = code
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/likearthian/go-http/router"
+	route "github.com/likearthian/go-http/router/v2"
+	log "github.com/likearthian/go-logger"
+	"github.com/tj/assert"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	lateWrite := make(chan error, 1)
+
+	rtr := router.NewRouter()
+	rtr.Use(router.MiddlewareFunc(MakeHttpTimeoutMiddleware(20 * time.Millisecond)))
+	rtr.Methods(http.MethodGet).Handler("/fast", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "fast")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "done")
+	}))
+	rtr.Methods(http.MethodGet).Handler("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(5 * time.Millisecond)
+		w.Header().Set("X-Handler", "slow")
+		_, err := io.WriteString(w, "too late")
+		lateWrite <- err
+	}))
+	rtr.Methods(http.MethodGet).Meta(gohttp.RouteMetadata{Timeout: 200 * time.Millisecond}).Handler("/report", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(40 * time.Millisecond)
+		_, _ = io.WriteString(w, "report")
+	}))
+	rtr.Methods(http.MethodGet).Meta(gohttp.RouteMetadata{Streaming: true}).Handler("/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, hasDeadline := r.Context().Deadline()
+		assert.False(t, hasDeadline)
+		_, isFlusher := w.(http.Flusher)
+		assert.True(t, isFlusher)
+		_, _ = io.WriteString(w, "data: 1\n\n")
+	}))
+	rtr.Methods(http.MethodGet).Handler("/panic", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := serve("/fast")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "fast", rec.Header().Get("X-Handler"))
+	assert.Equal(t, "done", rec.Body.String())
+
+	rec = serve("/slow")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, gohttp.HttpContentTypeJson, rec.Header().Get(gohttp.HeaderContentType))
+	assert.Equal(t, "{\"message\":\"request timed out after 20ms\"}\n", rec.Body.String())
+	assert.Equal(t, http.ErrHandlerTimeout, <-lateWrite)
+	assert.Empty(t, rec.Header().Get("X-Handler"))
+
+	rec = serve("/report")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "report", rec.Body.String())
+
+	rec = serve("/events")
+	assert.Equal(t, "data: 1\n\n", rec.Body.String())
+
+	// the panic reaches the serving goroutine, for the recovery middleware
+	func() {
+		defer func() {
+			assert.Equal(t, "boom", recover())
+		}()
+		serve("/panic")
+	}()
+}
+
+func TestTimeoutStatus(t *testing.T) {
+	h := MakeHttpTimeoutMiddleware(time.Millisecond, TimeoutStatus(http.StatusGatewayTimeout))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+}
+
+func TestTimeoutMiddlewareMux(t *testing.T) {
+	mx := route.NewRouter()
+	mx.Use(MakeHttpTimeoutMiddleware(20 * time.Millisecond))
+	api := mx.Subroute("/api")
+	api.Methods(http.MethodGet).Meta(gohttp.RouteMetadata{Timeout: 200 * time.Millisecond}).Handler("/report", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(40 * time.Millisecond)
+		_, _ = io.WriteString(w, "report")
+	}))
+	api.Methods(http.MethodGet).Meta(gohttp.RouteMetadata{Streaming: true}).Handler("/events", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, hasDeadline := r.Context().Deadline()
+		assert.False(t, hasDeadline)
+		_, isFlusher := w.(http.Flusher)
+		assert.True(t, isFlusher)
+		_, _ = io.WriteString(w, "data: 1\n\n")
+	}))
+	api.Methods(http.MethodGet).Handler("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mx.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := serve("/api/report")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "report", rec.Body.String())
+	assert.Equal(t, "data: 1\n\n", serve("/api/events").Body.String())
+	assert.Equal(t, http.StatusServiceUnavailable, serve("/api/slow").Code)
+}
+
+func TestTimeoutLatePanic(t *testing.T) {
+	logged := make(chan []interface{}, 1)
+	logger := log.LoggerFunc(func(keyvals ...interface{}) error {
+		logged <- keyvals
+		return nil
+	})
+
+	h := MakeHttpTimeoutMiddleware(time.Millisecond, TimeoutLogger(logger))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(5 * time.Millisecond)
+		panic("late boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	select {
+	case keyvals := <-logged:
+		fields := map[string]interface{}{}
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			fields[keyvals[i].(string)] = keyvals[i+1]
+		}
+		assert.Equal(t, "panic after timeout", fields["event"])
+		assert.Equal(t, "late boom", fields["panic"])
+	case <-time.After(time.Second):
+		t.Fatal("late panic not logged")
+	}
+}
+
+func TestTimeoutPanicRecovered(t *testing.T) {
+	errBoom := errors.New("boom")
+	var hooked interface{}
+	recovery := MakeHttpRecoveryMiddleware(captureLogger(map[string]interface{}{}), RecoveryHook(func(r *http.Request, rec interface{}, stack []byte) {
+		hooked = rec
+	}))
+
+	h := recovery(MakeHttpTimeoutMiddleware(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(errBoom)
+	})))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	err, ok := hooked.(error)
+	assert.True(t, ok)
+	assert.True(t, errors.Is(err, errBoom))
+}
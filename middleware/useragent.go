@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ua-parser/uap-go/uaparser"
+)
+
+const defaultUserAgentCacheSize = 1024
+
+// UserAgentParser parses user agent strings with the regex database of
+// uap-go, compiled once, and caches the results of the most recently seen
+// strings.
+type UserAgentParser struct {
+	once   sync.Once
+	parser *uaparser.Parser
+
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type userAgentEntry struct {
+	ua     string
+	client *uaparser.Client
+}
+
+// NewUserAgentParser creates a parser caching up to cacheSize user agents,
+// 1024 when zero. The regex database is compiled on the first Parse.
+func NewUserAgentParser(cacheSize int) *UserAgentParser {
+	if cacheSize <= 0 {
+		cacheSize = defaultUserAgentCacheSize
+	}
+	return &UserAgentParser{
+		size:  cacheSize,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+var defaultUserAgentParser = NewUserAgentParser(0)
+
+// Parse parses ua. The returned client is shared by the callers parsing the
+// same string and must not be modified.
+func (p *UserAgentParser) Parse(ua string) *uaparser.Client {
+	p.mu.Lock()
+	if el, ok := p.items[ua]; ok {
+		p.ll.MoveToFront(el)
+		client := el.Value.(*userAgentEntry).client
+		p.mu.Unlock()
+		return client
+	}
+	p.mu.Unlock()
+
+	p.once.Do(func() {
+		p.parser = uaparser.NewFromSaved()
+	})
+	client := p.parser.Parse(ua)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if el, ok := p.items[ua]; ok {
+		return el.Value.(*userAgentEntry).client
+	}
+	p.items[ua] = p.ll.PushFront(&userAgentEntry{ua: ua, client: client})
+	if p.ll.Len() > p.size {
+		oldest := p.ll.Back()
+		p.ll.Remove(oldest)
+		delete(p.items, oldest.Value.(*userAgentEntry).ua)
+	}
+	return client
+}
+
+// Len returns the number of cached user agents.
+func (p *UserAgentParser) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ll.Len()
+}
@@ -2,6 +2,7 @@ package http
 
 const (
 	HttpContentTypeJson          = "application/json"
+	HttpContentTypeYAML          = "application/yaml"
 	HttpContentTypeMultipartForm = "multipart/form-data"
 	HttpContentTypeUrlFormEncoded = "application/x-www-form-urlencoded"
 	HttpContentTypeXML = "application/xml; charset=utf-8"
@@ -0,0 +1,340 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/likearthian/go-http/router"
+	route "github.com/likearthian/go-http/router/v2"
+)
+
+type generator struct {
+	doc      *Document
+	registry *schemaRegistry
+}
+
+func newGenerator(info Info) *generator {
+	return &generator{
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   map[string]PathItem{},
+		},
+		registry: newSchemaRegistry(),
+	}
+}
+
+func (g *generator) document() *Document {
+	if len(g.registry.schemas) > 0 {
+		g.doc.Components = &Components{Schemas: g.registry.schemas}
+	}
+	return g.doc
+}
+
+// FromRouter generates the document of the routes registered on rtr. When
+// several routes share a path and method, e.g. on different hosts, the first
+// one registered is documented.
+func FromRouter(info Info, rtr *router.Router) *Document {
+	g := newGenerator(info)
+	for _, r := range rtr.Routes() {
+		path, pathSchemas := convertV1Path(r.Path)
+		for _, m := range r.Methods {
+			g.addOperation(m, path, pathSchemas, r.Metadata)
+		}
+	}
+
+	return g.document()
+}
+
+// FromRoutes generates the document of the routes of a router/v2 router,
+// including its sub routers. Path param constraints such as {id:int} are
+// documented in the param schema.
+func FromRoutes(info Info, routes route.Routes) *Document {
+	g := newGenerator(info)
+	g.addV2Routes("", routes)
+	return g.document()
+}
+
+func (g *generator) addV2Routes(prefix string, routes route.Routes) {
+	for _, r := range routes.Routes() {
+		if r.SubRoutes != nil {
+			g.addV2Routes(prefix+strings.TrimSuffix(r.Pattern, "/*"), r.SubRoutes)
+			continue
+		}
+
+		methods := make([]string, 0, len(r.Handlers))
+		for m := range r.Handlers {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+
+		path, pathSchemas := convertV2Path(prefix + r.Pattern)
+		for _, m := range methods {
+			g.addOperation(m, path, pathSchemas, r.Metadata[m])
+		}
+	}
+}
+
+func (g *generator) addOperation(method, path string, pathSchemas map[string]*Schema, meta *gohttp.RouteMetadata) {
+	method = strings.ToLower(method)
+	switch method {
+	case "get", "put", "post", "delete", "patch":
+	case "head", "options", "trace":
+		// only documented on request
+		if meta == nil {
+			return
+		}
+	default:
+		return
+	}
+
+	item, ok := g.doc.Paths[path]
+	if !ok {
+		item = PathItem{}
+		g.doc.Paths[path] = item
+	}
+	if _, exists := item[method]; exists {
+		return
+	}
+
+	op := &Operation{Responses: map[string]*Response{}}
+	item[method] = op
+
+	var request interface{}
+	if meta != nil {
+		op.Summary = meta.Summary
+		op.Description = meta.Description
+		op.OperationID = meta.OperationID
+		op.Tags = meta.Tags
+		op.Deprecated = meta.Deprecated
+		request = meta.Request
+
+		for code, resp := range meta.Responses {
+			op.Responses[strconv.Itoa(code)] = g.response(code, resp)
+		}
+	}
+
+	if len(op.Responses) == 0 {
+		op.Responses[strconv.Itoa(http.StatusOK)] = &Response{Description: http.StatusText(http.StatusOK)}
+	}
+
+	hasBody := method == "post" || method == "put" || method == "patch"
+	req := g.request(request, hasBody)
+
+	// path params come first, in the order of the path
+	for _, name := range pathParamNames(path) {
+		schema := pathSchemas[name]
+		if schema == nil {
+			schema = req.pathSchemas[name]
+		}
+		if schema == nil {
+			schema = &Schema{Type: "string"}
+		}
+		op.Parameters = append(op.Parameters, &Parameter{Name: name, In: "path", Required: true, Schema: schema})
+	}
+	op.Parameters = append(op.Parameters, req.params...)
+	op.RequestBody = req.body
+}
+
+func (g *generator) response(code int, resp interface{}) *Response {
+	r := &Response{Description: http.StatusText(code)}
+	if resp == nil {
+		return r
+	}
+
+	r.Content = map[string]*MediaType{
+		gohttp.HttpContentTypeJson: {Schema: g.registry.schemaOf(reflect.TypeOf(resp))},
+	}
+	return r
+}
+
+type requestDoc struct {
+	params      []*Parameter
+	pathSchemas map[string]*Schema
+	body        *RequestBody
+}
+
+// request documents the request type. Fields tagged path, query or header
+// become parameters and fields tagged form make up a form body. Untagged
+// struct fields are walked into, like BindURLQuery does; other untagged
+// fields belong to the JSON body when the method has one, and are bound
+// from the query by their field name otherwise.
+func (g *generator) request(request interface{}, hasBody bool) requestDoc {
+	doc := requestDoc{pathSchemas: map[string]*Schema{}}
+	if request == nil {
+		return doc
+	}
+
+	t := reflect.TypeOf(request)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		if hasBody {
+			doc.body = jsonBody(g.registry.schemaOf(t))
+		}
+		return doc
+	}
+
+	form := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	var bodyFields []reflect.StructField
+	g.walkRequest(t, &doc, form, &bodyFields, hasBody)
+
+	switch {
+	case len(form.Properties) > 0:
+		doc.body = &RequestBody{Content: map[string]*MediaType{
+			gohttp.HttpContentTypeUrlFormEncoded: {Schema: form},
+		}}
+	case len(bodyFields) > 0 && len(bodyFields) == t.NumField() && t.Name() != "":
+		doc.body = jsonBody(g.registry.schemaOf(t))
+	case len(bodyFields) > 0:
+		body := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		for _, f := range bodyFields {
+			if name, ok := jsonName(f); ok {
+				body.Properties[name] = g.registry.schemaOf(f.Type)
+			}
+		}
+		doc.body = jsonBody(body)
+	}
+
+	return doc
+}
+
+func (g *generator) walkRequest(t reflect.Type, doc *requestDoc, form *Schema, bodyFields *[]reflect.StructField, hasBody bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		tagged := false
+		for _, in := range []string{"path", "query", "header"} {
+			name := f.Tag.Get(in)
+			if name == "" {
+				continue
+			}
+			tagged = true
+			schema := g.registry.schemaOf(f.Type)
+			if in == "path" {
+				doc.pathSchemas[name] = schema
+				continue
+			}
+			doc.params = append(doc.params, &Parameter{Name: name, In: in, Schema: schema})
+		}
+
+		if name := f.Tag.Get("form"); name != "" {
+			form.Properties[name] = g.registry.schemaOf(f.Type)
+			tagged = true
+		}
+
+		if tagged {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Struct && !isTextType(ft) {
+			g.walkRequest(ft, doc, form, bodyFields, hasBody)
+			continue
+		}
+
+		if hasBody {
+			*bodyFields = append(*bodyFields, f)
+			continue
+		}
+
+		doc.params = append(doc.params, &Parameter{Name: f.Name, In: "query", Schema: g.registry.schemaOf(f.Type)})
+	}
+}
+
+func jsonBody(schema *Schema) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content:  map[string]*MediaType{gohttp.HttpContentTypeJson: {Schema: schema}},
+	}
+}
+
+func pathParamNames(path string) []string {
+	var names []string
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			names = append(names, seg[1:len(seg)-1])
+		}
+	}
+	return names
+}
+
+// convertV1Path rewrites a httprouter path, /files/:dir/*name, into an
+// OpenAPI path, /files/{dir}/{name}.
+func convertV1Path(path string) (string, map[string]*Schema) {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			segs[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segs, "/"), nil
+}
+
+// convertV2Path rewrites a router/v2 pattern into an OpenAPI path, and
+// returns the schemas implied by the param constraints.
+func convertV2Path(pattern string) (string, map[string]*Schema) {
+	schemas := map[string]*Schema{}
+	var b strings.Builder
+	for len(pattern) > 0 {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			b.WriteString(pattern)
+			break
+		}
+		b.WriteString(pattern[:start])
+
+		depth, end := 0, -1
+		for i := start; i < len(pattern) && end < 0; i++ {
+			switch pattern[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			b.WriteString(pattern[start:])
+			break
+		}
+
+		name := strings.TrimSuffix(pattern[start+1:end], "...")
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			schemas[name[:i]] = constraintSchema(name[i+1:])
+			name = name[:i]
+		}
+		b.WriteString("{" + name + "}")
+		pattern = pattern[end+1:]
+	}
+
+	return b.String(), schemas
+}
+
+func constraintSchema(constraint string) *Schema {
+	switch constraint {
+	case "int":
+		return &Schema{Type: "integer", Format: "int64"}
+	case "uint":
+		zero := 0.0
+		return &Schema{Type: "integer", Format: "int64", Minimum: &zero}
+	case "float":
+		return &Schema{Type: "number", Format: "double"}
+	case "bool":
+		return &Schema{Type: "boolean"}
+	case "date":
+		return &Schema{Type: "string", Format: "date"}
+	case "uuid":
+		return &Schema{Type: "string", Format: "uuid"}
+	}
+	return &Schema{Type: "string", Pattern: "^(?:" + constraint + ")$"}
+}
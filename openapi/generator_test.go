@@ -0,0 +1,151 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/likearthian/go-http/router"
+	route "github.com/likearthian/go-http/router/v2"
+	tp "github.com/likearthian/types"
+	"github.com/tj/assert"
+)
+
+type Pagination struct {
+	Page  int `query:"page"`
+	Limit int `query:"limit"`
+}
+
+type listOrdersRequest struct {
+	Pagination
+	CustomerID string           `path:"customer_id"`
+	Status     tp.SliceOfString `query:"status"`
+	Detailed   tp.Boolean       `query:"detailed"`
+	TraceID    string           `header:"X-Trace-Id"`
+	Since      *time.Time       `query:"since"`
+}
+
+type createOrderRequest struct {
+	CustomerID string  `path:"customer_id"`
+	Items      []Item  `json:"items"`
+	Note       *string `json:"note,omitempty"`
+}
+
+type Item struct {
+	SKU      string  `json:"sku"`
+	Quantity int     `json:"quantity"`
+	Price    float64 `json:"price"`
+}
+
+type Order struct {
+	ID        int64     `json:"id"`
+	Items     []Item    `json:"items"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+var noop = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestFromRouter(t *testing.T) {
+	rtr := router.NewRouter()
+	customers := rtr.Subroute("/customers/:customer_id")
+	customers.Methods(http.MethodGet).Meta(gohttp.RouteMetadata{
+		Summary:   "List orders",
+		Tags:      []string{"orders"},
+		Request:   listOrdersRequest{},
+		Responses: map[int]interface{}{200: []Order{}, 404: ErrorResponse{}},
+	}).Handler("/orders", noop)
+	customers.Methods(http.MethodPost).Meta(gohttp.RouteMetadata{
+		Summary:   "Create order",
+		Request:   createOrderRequest{},
+		Responses: map[int]interface{}{201: Order{}, 204: nil},
+	}).Handler("/orders", noop)
+	rtr.Static("/static", http.Dir("."))
+
+	doc := FromRouter(Info{Title: "orders", Version: "1.0"}, rtr)
+
+	list := doc.Paths["/customers/{customer_id}/orders"]["get"]
+	assert.NotNil(t, list)
+	assert.Equal(t, "List orders", list.Summary)
+	assert.Equal(t, []string{"orders"}, list.Tags)
+
+	params := map[string]*Parameter{}
+	for _, p := range list.Parameters {
+		params[p.In+":"+p.Name] = p
+	}
+	assert.Equal(t, "path:customer_id", list.Parameters[0].In+":"+list.Parameters[0].Name)
+	assert.True(t, params["path:customer_id"].Required)
+	assert.Equal(t, "integer", params["query:page"].Schema.Type)
+	assert.Equal(t, "integer", params["query:limit"].Schema.Type)
+	assert.Equal(t, "array", params["query:status"].Schema.Type)
+	// text unmarshalers are documented as strings
+	assert.Equal(t, "string", params["query:detailed"].Schema.Type)
+	assert.Equal(t, "date-time", params["query:since"].Schema.Format)
+	assert.Equal(t, "string", params["header:X-Trace-Id"].Schema.Type)
+
+	assert.Equal(t, "array", list.Responses["200"].Content[gohttp.HttpContentTypeJson].Schema.Type)
+	assert.Equal(t, "#/components/schemas/Order", list.Responses["200"].Content[gohttp.HttpContentTypeJson].Schema.Items.Ref)
+	assert.Equal(t, "#/components/schemas/ErrorResponse", list.Responses["404"].Content[gohttp.HttpContentTypeJson].Schema.Ref)
+
+	create := doc.Paths["/customers/{customer_id}/orders"]["post"]
+	body := create.RequestBody.Content[gohttp.HttpContentTypeJson].Schema
+	assert.Equal(t, "object", body.Type)
+	assert.Equal(t, "#/components/schemas/Item", body.Properties["items"].Items.Ref)
+	assert.True(t, body.Properties["note"].Nullable)
+	assert.Nil(t, body.Properties["CustomerID"])
+	assert.Nil(t, create.Responses["204"].Content)
+
+	order := doc.Components.Schemas["Order"]
+	assert.Equal(t, "integer", order.Properties["id"].Type)
+	assert.Equal(t, "date-time", order.Properties["created_at"].Format)
+
+	assert.NotNil(t, doc.Paths["/static/{filepath}"]["get"])
+	assert.Nil(t, doc.Paths["/static/{filepath}"]["head"])
+}
+
+func TestFromRoutes(t *testing.T) {
+	mx := route.NewRouter()
+	api := mx.Subroute("/api")
+	api.Methods(http.MethodGet).Meta(gohttp.RouteMetadata{
+		Summary:   "Daily report",
+		Responses: map[int]interface{}{200: map[string]float64{}},
+	}).Handler("/reports/{day:date}/{id:int}", noop)
+	api.Methods(http.MethodDelete).Handler("/orders/{id:[0-9]+}", noop)
+
+	doc := FromRoutes(Info{Title: "reports", Version: "1.0"}, mx)
+
+	report := doc.Paths["/api/reports/{day}/{id}"]["get"]
+	assert.Equal(t, "Daily report", report.Summary)
+	assert.Equal(t, "date", report.Parameters[0].Schema.Format)
+	assert.Equal(t, "integer", report.Parameters[1].Schema.Type)
+	assert.Equal(t, "number", report.Responses["200"].Content[gohttp.HttpContentTypeJson].Schema.AdditionalProperties.Type)
+
+	del := doc.Paths["/api/orders/{id}"]["delete"]
+	assert.Equal(t, "^(?:[0-9]+)$", del.Parameters[0].Schema.Pattern)
+	assert.NotNil(t, del.Responses["200"])
+}
+
+func TestHandler(t *testing.T) {
+	doc := FromRoutes(Info{Title: "empty", Version: "1.0"}, route.NewRouter())
+	h := Handler(doc)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, gohttp.HttpContentTypeJson, rec.Header().Get(gohttp.HeaderContentType))
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &decoded))
+	assert.Equal(t, Version, decoded["openapi"])
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.yaml", nil))
+	assert.Equal(t, gohttp.HttpContentTypeYAML, rec.Header().Get(gohttp.HeaderContentType))
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "openapi: 3.0.3"))
+}
@@ -0,0 +1,38 @@
+package openapi
+
+import (
+	"net/http"
+	"strings"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+// Handler serves doc as JSON, or as YAML when the request path ends with
+// .yaml or .yml, or when the Accept header asks for YAML. The document is
+// encoded once, when the handler is created.
+func Handler(doc *Document) http.Handler {
+	jsonDoc, jsonErr := doc.JSON()
+	yamlDoc, yamlErr := doc.YAML()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, contentType, err := jsonDoc, gohttp.HttpContentTypeJson, jsonErr
+		if wantsYAML(r) {
+			body, contentType, err = yamlDoc, gohttp.HttpContentTypeYAML, yamlErr
+		}
+
+		if err != nil {
+			http.Error(w, "failed to encode openapi document", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(gohttp.HeaderContentType, contentType)
+		_, _ = w.Write(body)
+	})
+}
+
+func wantsYAML(r *http.Request) bool {
+	if strings.HasSuffix(r.URL.Path, ".yaml") || strings.HasSuffix(r.URL.Path, ".yml") {
+		return true
+	}
+	return strings.Contains(r.Header.Get(gohttp.HeaderAccept), "yaml")
+}
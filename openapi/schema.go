@@ -0,0 +1,159 @@
+package openapi
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// schemaRegistry builds schemas from Go types. Named struct types are
+// registered once in the components of the document and referenced.
+type schemaRegistry struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+	}
+}
+
+// isTextType reports whether values of t are bound from their text form,
+// as done by BindURLQuery for encoding.TextUnmarshaler types.
+func isTextType(t reflect.Type) bool {
+	return t.Implements(textUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+func (sr *schemaRegistry) schemaOf(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	s := sr.schemaOfElem(t)
+	if nullable && s.Ref == "" {
+		s.Nullable = true
+	}
+	return s
+}
+
+func (sr *schemaRegistry) schemaOfElem(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	if isTextType(t) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: sr.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: sr.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sr.structSchema(t, nil)
+		}
+		return &Schema{Ref: "#/components/schemas/" + sr.register(t)}
+	}
+
+	return &Schema{}
+}
+
+// register adds the schema of the named struct type t to the components and
+// returns its name.
+func (sr *schemaRegistry) register(t reflect.Type) string {
+	if name, ok := sr.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := sr.schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+
+	sr.names[t] = name
+	// reserve the name first, so recursive types terminate
+	sr.schemas[name] = &Schema{}
+	*sr.schemas[name] = *sr.structSchema(t, nil)
+
+	return name
+}
+
+// structSchema builds the object schema of t from the json names of its
+// fields. Fields for which skip returns true are left out.
+func (sr *schemaRegistry) structSchema(t reflect.Type, skip func(reflect.StructField) bool) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	sr.addProperties(s, t, skip)
+	return s
+}
+
+func (sr *schemaRegistry) addProperties(s *Schema, t reflect.Type, skip func(reflect.StructField) bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if skip != nil && skip(f) {
+			continue
+		}
+
+		name, ok := jsonName(f)
+		if !ok {
+			continue
+		}
+
+		ft := f.Type
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !isTextType(ft) {
+				sr.addProperties(s, ft, skip)
+				continue
+			}
+		}
+
+		s.Properties[name] = sr.schemaOf(f.Type)
+	}
+}
+
+// jsonName returns the name of the field in its json encoding.
+func jsonName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+
+	return name, true
+}
@@ -0,0 +1,679 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/likearthian/go-http/router"
+	route "github.com/likearthian/go-http/router/v2"
+	log "github.com/likearthian/go-logger"
+	"github.com/likearthian/go-logger/level"
+)
+
+// ValidationError describes a single violation of the document by a request.
+// In is path, query, header or body, and Name is the param name or the
+// location in the body, e.g. items[0].sku.
+type ValidationError struct {
+	In      string `json:"in"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Name == "" {
+		return e.In + ": " + e.Message
+	}
+	return e.In + " " + e.Name + ": " + e.Message
+}
+
+// ValidationErrorResponse is the body of the 400 response sent for a
+// request that fails validation.
+type ValidationErrorResponse struct {
+	Message string            `json:"message"`
+	Errors  []ValidationError `json:"errors"`
+}
+
+// DefaultValidatorMaxBodySize is the maximum size of a request body read
+// for validation.
+const DefaultValidatorMaxBodySize = 10 << 20
+
+var errRequestBodyTooLarge = errors.New("request body too large")
+
+type ValidatorOption func(*validatorConfig)
+
+type validatorConfig struct {
+	reportOnly  bool
+	logger      log.Logger
+	basePath    string
+	maxBodySize int64
+}
+
+// ValidatorReportOnly makes the validator log violations and pass the
+// request on instead of rejecting it.
+func ValidatorReportOnly(reportOnly bool) ValidatorOption {
+	return func(c *validatorConfig) {
+		c.reportOnly = reportOnly
+	}
+}
+
+// ValidatorLogger sets the logger violations are reported to.
+func ValidatorLogger(logger log.Logger) ValidatorOption {
+	return func(c *validatorConfig) {
+		c.logger = logger
+	}
+}
+
+// ValidatorMaxBodySize sets the maximum size of the JSON bodies read for
+// validation, DefaultValidatorMaxBodySize by default. Larger requests are
+// answered with 413 Request Entity Too Large.
+func ValidatorMaxBodySize(n int64) ValidatorOption {
+	return func(c *validatorConfig) {
+		c.maxBodySize = n
+	}
+}
+
+// ValidatorBasePath sets the prefix the document paths are served under,
+// e.g. the path of the document server URL.
+func ValidatorBasePath(basePath string) ValidatorOption {
+	return func(c *validatorConfig) {
+		c.basePath = strings.TrimSuffix(basePath, "/")
+	}
+}
+
+// MakeRequestValidatorMiddleware returns a middleware validating requests
+// against the operations of doc. Path, query and header params and JSON
+// request bodies are checked against their schemas; a request violating
+// them is answered with a 400 carrying a ValidationErrorResponse before the
+// handler runs. Requests which path or method is not in the document are
+// passed on untouched, leaving 404 and 405 to the router.
+//
+// The operation is found by the pattern of the route when the middleware runs
+// inside a router or router/v2 router, including as a middleware of a Mux,
+// and by matching the request path against the document paths otherwise.
+func MakeRequestValidatorMiddleware(doc *Document, options ...ValidatorOption) func(http.Handler) http.Handler {
+	config := &validatorConfig{
+		logger:      log.LoggerFunc(func(...interface{}) error { return nil }),
+		maxBodySize: DefaultValidatorMaxBodySize,
+	}
+	for _, opt := range options {
+		opt(config)
+	}
+
+	v := newValidator(doc, config)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			errs, err := v.validate(r)
+			if err == errRequestBodyTooLarge && !config.reportOnly {
+				w.Header().Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				_ = json.NewEncoder(w).Encode(ValidationErrorResponse{Message: err.Error()})
+				return
+			}
+			if len(errs) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			msgs := make([]string, len(errs))
+			for i, e := range errs {
+				msgs[i] = e.Error()
+			}
+			_ = level.Warn(config.logger).Log(
+				"event", "request validation failed",
+				"method", r.Method,
+				"uri", r.RequestURI,
+				"errors", strings.Join(msgs, "; "),
+				"report-only", config.reportOnly,
+			)
+
+			if config.reportOnly {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(ValidationErrorResponse{
+				Message: "request validation failed",
+				Errors:  errs,
+			})
+		})
+	}
+}
+
+type validator struct {
+	config  *validatorConfig
+	schemas map[string]*Schema
+	paths   map[string]PathItem
+	// document paths, most specific first
+	templates []pathTemplate
+
+	patterns sync.Map // pattern string -> *regexp.Regexp
+}
+
+type pathTemplate struct {
+	path string
+	segs []string
+}
+
+func newValidator(doc *Document, config *validatorConfig) *validator {
+	v := &validator{config: config, paths: doc.Paths}
+	if doc.Components != nil {
+		v.schemas = doc.Components.Schemas
+	}
+
+	for path := range doc.Paths {
+		v.templates = append(v.templates, pathTemplate{path: path, segs: strings.Split(path, "/")})
+	}
+
+	// concrete paths are matched before templated ones, as in
+	// /users/me and /users/{id}
+	sort.Slice(v.templates, func(i, j int) bool {
+		a, b := v.templates[i].segs, v.templates[j].segs
+		for k := 0; k < len(a) && k < len(b); k++ {
+			pa, pb := isTemplateSegment(a[k]), isTemplateSegment(b[k])
+			if pa != pb {
+				return pb
+			}
+		}
+		return v.templates[i].path < v.templates[j].path
+	})
+
+	return v
+}
+
+func isTemplateSegment(seg string) bool {
+	return strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")
+}
+
+// operation returns the operation serving r and its path params. The
+// operation is found by the pattern of the matched route when there is one,
+// and by matching the path against the document paths otherwise.
+func (v *validator) operation(r *http.Request) (*Operation, map[string]string) {
+	method := strings.ToLower(r.Method)
+	ctx := r.Context()
+
+	path := r.URL.Path
+	if v.config.basePath != "" {
+		if !strings.HasPrefix(path, v.config.basePath) {
+			return nil, nil
+		}
+		path = path[len(v.config.basePath):]
+	}
+	segs := strings.Split(path, "/")
+
+	if pattern := route.RoutePatternFromContext(ctx); pattern != "" {
+		docPath, _ := convertV2Path(pattern)
+		if op := v.paths[strings.TrimPrefix(docPath, v.config.basePath)][method]; op != nil {
+			params := map[string]string{}
+			for _, p := range route.GetParamsFromContext(ctx) {
+				params[p.Key] = p.Value
+			}
+			return op, params
+		}
+	} else if pattern := router.RoutePatternFromContext(ctx); pattern != "" {
+		docPath, _ := convertV1Path(pattern)
+		if op := v.paths[strings.TrimPrefix(docPath, v.config.basePath)][method]; op != nil {
+			params := map[string]string{}
+			for _, p := range router.GetParamsFromContext(ctx) {
+				params[p.Key] = p.Value
+			}
+			return op, params
+		}
+	} else if pattern := gohttp.RoutePatternFromContext(ctx); pattern != "" {
+		// router/v2 resolves the route before the middlewares of the Mux,
+		// but captures its params only once routing
+		docPath, _ := convertV2Path(pattern)
+		docPath = strings.TrimPrefix(docPath, v.config.basePath)
+		for _, t := range v.templates {
+			if t.path != docPath || v.paths[t.path][method] == nil {
+				continue
+			}
+			if params, ok := t.match(segs); ok {
+				return v.paths[t.path][method], params
+			}
+		}
+	}
+
+	for _, t := range v.templates {
+		op := v.paths[t.path][method]
+		if op == nil {
+			continue
+		}
+		if params, ok := t.match(segs); ok {
+			return op, params
+		}
+	}
+
+	return nil, nil
+}
+
+// match matches the segments of a request path against the template, and
+// returns the values of its params.
+func (t pathTemplate) match(segs []string) (map[string]string, bool) {
+	if len(t.segs) != len(segs) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, seg := range t.segs {
+		if isTemplateSegment(seg) {
+			if segs[i] == "" {
+				return nil, false
+			}
+			params[seg[1:len(seg)-1]] = segs[i]
+			continue
+		}
+		if seg != segs[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (v *validator) validate(r *http.Request) ([]ValidationError, error) {
+	op, pathParams := v.operation(r)
+	if op == nil {
+		return nil, nil
+	}
+
+	var errs []ValidationError
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var values []string
+		switch p.In {
+		case "path":
+			if value, ok := pathParams[p.Name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			if p.Required {
+				errs = append(errs, ValidationError{In: p.In, Name: p.Name, Message: "is required"})
+			}
+			continue
+		}
+
+		if p.Schema == nil {
+			continue
+		}
+
+		value, err := v.paramValue(p.Schema, values)
+		if err != nil {
+			errs = append(errs, ValidationError{In: p.In, Name: p.Name, Message: err.Error()})
+			continue
+		}
+		errs = v.validateValue(errs, p.In, p.Name, p.Schema, value)
+	}
+
+	if op.RequestBody != nil {
+		return v.validateBody(errs, r, op.RequestBody)
+	}
+
+	return errs, nil
+}
+
+// paramValue converts the raw values of a param to the JSON value its
+// schema describes. Arrays are given as repeated params or comma separated,
+// as BindURLQuery accepts them.
+func (v *validator) paramValue(schema *Schema, values []string) (interface{}, error) {
+	schema = v.resolve(schema)
+	if schema.Type != "array" {
+		return scalarParamValue(schema, values[0])
+	}
+
+	var items []interface{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if schema.Items == nil {
+				items = append(items, item)
+				continue
+			}
+			converted, err := scalarParamValue(v.resolve(schema.Items), item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, converted)
+		}
+	}
+	return items, nil
+}
+
+func scalarParamValue(schema *Schema, value string) (interface{}, error) {
+	switch schema.Type {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return json.Number(value), nil
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return json.Number(value), nil
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+// validateBody validates a JSON request body and restores it for the
+// handler. Bodies of other media types are not read, only their presence is
+// checked. A body larger than the maximum size is not validated and fails
+// with errRequestBodyTooLarge.
+func (v *validator) validateBody(errs []ValidationError, r *http.Request, body *RequestBody) ([]ValidationError, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get(gohttp.HeaderContentType))
+	if mediaType == "" {
+		mediaType = gohttp.HttpContentTypeJson
+	}
+	media, ok := body.Content[mediaType]
+
+	if !ok || !isJSONMediaType(mediaType) || media == nil || media.Schema == nil {
+		empty, err := emptyBody(r)
+		if err != nil {
+			return append(errs, ValidationError{In: "body", Message: "failed to read body"}), nil
+		}
+		if empty {
+			if body.Required {
+				errs = append(errs, ValidationError{In: "body", Message: "is required"})
+			}
+			return errs, nil
+		}
+		if !ok {
+			errs = append(errs, ValidationError{In: "body", Message: fmt.Sprintf("unsupported content type %q", mediaType)})
+		}
+		return errs, nil
+	}
+
+	data, err := readBody(r, v.config.maxBodySize)
+	if err == errRequestBodyTooLarge {
+		return errs, err
+	}
+	if err != nil {
+		return append(errs, ValidationError{In: "body", Message: "failed to read body"}), nil
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.Required {
+			errs = append(errs, ValidationError{In: "body", Message: "is required"})
+		}
+		return errs, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return append(errs, ValidationError{In: "body", Message: "invalid JSON: " + err.Error()}), nil
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return append(errs, ValidationError{In: "body", Message: "invalid JSON: trailing data"}), nil
+	}
+
+	return v.validateValue(errs, "body", "", media.Schema, value), nil
+}
+
+// bodyReader is a request body partly read by the validator, the read part
+// being replayed before the rest.
+type bodyReader struct {
+	io.Reader
+	io.Closer
+}
+
+// emptyBody reports whether r has no body, reading a byte of it at most.
+func emptyBody(r *http.Request) (bool, error) {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return true, nil
+	}
+	if r.ContentLength > 0 {
+		return false, nil
+	}
+
+	var b [1]byte
+	n, err := io.ReadFull(r.Body, b[:])
+	if n == 0 {
+		if err == io.EOF {
+			return true, nil
+		}
+		return false, err
+	}
+	r.Body = bodyReader{Reader: io.MultiReader(bytes.NewReader(b[:n]), r.Body), Closer: r.Body}
+	return false, nil
+}
+
+// readBody reads the body of r up to max bytes, and restores it for the
+// handler, including when it is larger.
+func readBody(r *http.Request, max int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	if max > 0 && r.ContentLength > max {
+		return nil, errRequestBodyTooLarge
+	}
+
+	src := r.Body
+	if max > 0 {
+		src = ioutil.NopCloser(io.LimitReader(r.Body, max+1))
+	}
+	data, err := ioutil.ReadAll(src)
+	r.Body = bodyReader{Reader: io.MultiReader(bytes.NewReader(data), r.Body), Closer: r.Body}
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && int64(len(data)) > max {
+		return nil, errRequestBodyTooLarge
+	}
+	return data, nil
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == gohttp.HttpContentTypeJson || strings.HasSuffix(mediaType, "+json")
+}
+
+// resolve follows the $ref of a schema into the document components.
+func (v *validator) resolve(schema *Schema) *Schema {
+	for i := 0; schema.Ref != "" && i < 32; i++ {
+		ref, ok := v.schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return &Schema{}
+		}
+		schema = ref
+	}
+	return schema
+}
+
+func (v *validator) validateValue(errs []ValidationError, in, name string, schema *Schema, value interface{}) []ValidationError {
+	schema = v.resolve(schema)
+	fail := func(format string, args ...interface{}) []ValidationError {
+		return append(errs, ValidationError{In: in, Name: name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return errs
+		}
+		return fail("must not be null")
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		allowed := make([]string, len(schema.Enum))
+		for i, e := range schema.Enum {
+			allowed[i] = fmt.Sprint(e)
+		}
+		return fail("must be one of %s", strings.Join(allowed, ", "))
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("must be an object")
+		}
+		for _, req := range schema.Required {
+			if _, ok := obj[req]; !ok {
+				errs = append(errs, ValidationError{In: in, Name: joinName(name, req), Message: "is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if prop, ok := schema.Properties[k]; ok {
+				errs = v.validateValue(errs, in, joinName(name, k), prop, obj[k])
+				continue
+			}
+			if schema.noAdditionalProperties {
+				errs = append(errs, ValidationError{In: in, Name: joinName(name, k), Message: "is not allowed"})
+				continue
+			}
+			if schema.AdditionalProperties != nil {
+				errs = v.validateValue(errs, in, joinName(name, k), schema.AdditionalProperties, obj[k])
+			}
+		}
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fail("must be an array")
+		}
+		if schema.MinItems != nil && len(arr) < *schema.MinItems {
+			return fail("must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(arr) > *schema.MaxItems {
+			return fail("must have at most %d items", *schema.MaxItems)
+		}
+		if schema.Items != nil {
+			for i, item := range arr {
+				errs = v.validateValue(errs, in, fmt.Sprintf("%s[%d]", name, i), schema.Items, item)
+			}
+		}
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		n := utf8.RuneCountInString(s)
+		if schema.MinLength != nil && n < *schema.MinLength {
+			return fail("must be at least %d characters long", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && n > *schema.MaxLength {
+			return fail("must be at most %d characters long", *schema.MaxLength)
+		}
+		if schema.Pattern != "" {
+			re, err := v.pattern(schema.Pattern)
+			if err != nil {
+				return fail("invalid pattern in document: %s", err)
+			}
+			if !re.MatchString(s) {
+				return fail("must match pattern %s", schema.Pattern)
+			}
+		}
+
+	case "integer", "number":
+		num, ok := value.(json.Number)
+		if !ok {
+			return fail("must be a %s", schema.Type)
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return fail("must be a %s", schema.Type)
+		}
+		if schema.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				return fail("must be an integer")
+			}
+		}
+		if schema.Minimum != nil {
+			if schema.ExclusiveMinimum && f <= *schema.Minimum {
+				return fail("must be greater than %v", *schema.Minimum)
+			}
+			if f < *schema.Minimum {
+				return fail("must be at least %v", *schema.Minimum)
+			}
+		}
+		if schema.Maximum != nil {
+			if schema.ExclusiveMaximum && f >= *schema.Maximum {
+				return fail("must be less than %v", *schema.Maximum)
+			}
+			if f > *schema.Maximum {
+				return fail("must be at most %v", *schema.Maximum)
+			}
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("must be a boolean")
+		}
+	}
+
+	return errs
+}
+
+func (v *validator) pattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := v.patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	v.patterns.Store(pattern, re)
+	return re, nil
+}
+
+// inEnum compares value with the enum members by their text, so that a
+// number decoded from a request matches the same number in the document
+// whatever its Go type.
+func inEnum(enum []interface{}, value interface{}) bool {
+	if num, ok := value.(json.Number); ok {
+		if f, err := num.Float64(); err == nil {
+			value = f
+		}
+	}
+
+	s := fmt.Sprint(value)
+	for _, e := range enum {
+		if fmt.Sprint(e) == s {
+			return true
+		}
+	}
+	return false
+}
+
+func joinName(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,304 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/likearthian/go-http/router"
+	route "github.com/likearthian/go-http/router/v2"
+	log "github.com/likearthian/go-logger"
+	"github.com/tj/assert"
+)
+
+const ordersSpec = `
+openapi: 3.0.3
+info:
+  title: orders
+  version: "1.0"
+paths:
+  /orders/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: integer
+          minimum: 1
+    get:
+      parameters:
+        - name: X-Tenant
+          in: header
+          required: true
+          schema:
+            type: string
+            pattern: "^[a-z]+$"
+      responses:
+        "200":
+          description: OK
+  /orders/latest:
+    get:
+      responses:
+        "200":
+          description: OK
+  /orders:
+    get:
+      parameters:
+        - name: status
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+              enum: [open, closed]
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            maximum: 100
+      responses:
+        "200":
+          description: OK
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/NewOrder'
+      responses:
+        "201":
+          description: Created
+components:
+  schemas:
+    NewOrder:
+      type: object
+      required: [items]
+      additionalProperties: false
+      properties:
+        note:
+          type: string
+          maxLength: 10
+          nullable: true
+        items:
+          type: array
+          minItems: 1
+          items:
+            type: object
+            required: [sku, quantity]
+            properties:
+              sku:
+                type: string
+              quantity:
+                type: integer
+                minimum: 1
+`
+
+func validationErrors(t *testing.T, rec *httptest.ResponseRecorder) []ValidationError {
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, gohttp.HttpContentTypeJson, rec.Header().Get(gohttp.HeaderContentType))
+
+	var resp ValidationErrorResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp.Errors
+}
+
+func TestParse(t *testing.T) {
+	doc, err := Parse([]byte(ordersSpec))
+	assert.NoError(t, err)
+
+	// path level params are merged into the operations
+	get := doc.Paths["/orders/{id}"]["get"]
+	assert.Len(t, get.Parameters, 2)
+	assert.Equal(t, "X-Tenant", get.Parameters[0].Name)
+	assert.Equal(t, "id", get.Parameters[1].Name)
+
+	data, err := doc.JSON()
+	assert.NoError(t, err)
+	fromJSON, err := Parse(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "integer", fromJSON.Paths["/orders/{id}"]["get"].Parameters[1].Schema.Type)
+
+	_, err = Parse([]byte(`{"swagger": "2.0"}`))
+	assert.Error(t, err)
+}
+
+func TestRequestValidator(t *testing.T) {
+	doc, err := Parse([]byte(ordersSpec))
+	assert.NoError(t, err)
+
+	var body string
+	h := MakeRequestValidatorMiddleware(doc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(method, target, reqBody string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(reqBody))
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/orders/12", "", "X-Tenant", "acme")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	errs := validationErrors(t, serve(http.MethodGet, "/orders/0", ""))
+	assert.Equal(t, []ValidationError{
+		{In: "header", Name: "X-Tenant", Message: "is required"},
+		{In: "path", Name: "id", Message: "must be at least 1"},
+	}, errs)
+
+	errs = validationErrors(t, serve(http.MethodGet, "/orders/abc", "", "X-Tenant", "ACME"))
+	assert.Equal(t, "must match pattern ^[a-z]+$", errs[0].Message)
+	assert.Equal(t, "must be an integer", errs[1].Message)
+
+	// concrete paths win over templates
+	rec = serve(http.MethodGet, "/orders/latest", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(http.MethodGet, "/orders?status=open,closed&status=open&limit=100", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	errs = validationErrors(t, serve(http.MethodGet, "/orders?status=open,lost&limit=101", ""))
+	assert.Equal(t, []ValidationError{
+		{In: "query", Name: "status[1]", Message: "must be one of open, closed"},
+		{In: "query", Name: "limit", Message: "must be at most 100"},
+	}, errs)
+
+	rec = serve(http.MethodPost, "/orders", `{"items":[{"sku":"a","quantity":2}],"note":null}`,
+		gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// the handler still reads the body
+	assert.Equal(t, `{"items":[{"sku":"a","quantity":2}],"note":null}`, body)
+
+	errs = validationErrors(t, serve(http.MethodPost, "/orders", `{"items":[{"sku":1,"quantity":1.5},{}],"note":"far too long","extra":true}`))
+	assert.Equal(t, []ValidationError{
+		{In: "body", Name: "extra", Message: "is not allowed"},
+		{In: "body", Name: "items[0].quantity", Message: "must be an integer"},
+		{In: "body", Name: "items[0].sku", Message: "must be a string"},
+		{In: "body", Name: "items[1].sku", Message: "is required"},
+		{In: "body", Name: "items[1].quantity", Message: "is required"},
+		{In: "body", Name: "note", Message: "must be at most 10 characters long"},
+	}, errs)
+
+	errs = validationErrors(t, serve(http.MethodPost, "/orders", ""))
+	assert.Equal(t, []ValidationError{{In: "body", Message: "is required"}}, errs)
+
+	errs = validationErrors(t, serve(http.MethodPost, "/orders", "a=b", gohttp.HeaderContentType, gohttp.HttpContentTypeUrlFormEncoded))
+	assert.Equal(t, `unsupported content type "application/x-www-form-urlencoded"`, errs[0].Message)
+
+	// unknown paths and methods are left to the router
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/customers", "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/orders", "").Code)
+}
+
+func TestRequestValidatorReportOnly(t *testing.T) {
+	doc, err := Parse([]byte(ordersSpec))
+	assert.NoError(t, err)
+
+	var logged []interface{}
+	logger := log.LoggerFunc(func(keyvals ...interface{}) error {
+		logged = keyvals
+		return nil
+	})
+
+	mx := route.NewRouter()
+	mx.Use(MakeRequestValidatorMiddleware(doc, ValidatorReportOnly(true), ValidatorLogger(logger), ValidatorBasePath("/api/")))
+	mx.Methods(http.MethodGet).Handler("/api/orders/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	rec := httptest.NewRecorder()
+	mx.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/orders/x", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Contains(t, logged, "request validation failed")
+	assert.Contains(t, logged, "header X-Tenant: is required; path id: must be an integer")
+}
+
+func TestRequestValidatorRoutePattern(t *testing.T) {
+	doc, err := Parse([]byte(ordersSpec))
+	assert.NoError(t, err)
+
+	validate := MakeRequestValidatorMiddleware(doc)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	rtr := router.NewRouter()
+	rtr.Use(router.MiddlewareFunc(validate))
+	rtr.Methods(http.MethodGet).Handler("/orders/:id", ok)
+
+	mx := route.NewRouter()
+	mx.Use(validate)
+	mx.Methods(http.MethodGet).Handler("/orders/{id}", ok)
+
+	// /orders/latest is served by the /orders/{id} route, so it is validated
+	// as such rather than by the closest document path
+	for _, h := range []http.Handler{rtr, mx} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/latest", nil))
+		assert.Equal(t, []ValidationError{
+			{In: "header", Name: "X-Tenant", Message: "is required"},
+			{In: "path", Name: "id", Message: "must be an integer"},
+		}, validationErrors(t, rec))
+	}
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestRequestValidatorBodySize(t *testing.T) {
+	doc, err := Parse([]byte(ordersSpec))
+	assert.NoError(t, err)
+
+	var body string
+	read := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+	})
+	h := MakeRequestValidatorMiddleware(doc, ValidatorMaxBodySize(64))(read)
+
+	large := `{"items":[{"sku":"a","quantity":2}],"note":"` + strings.Repeat("x", 64) + `"}`
+	for _, length := range []int64{int64(len(large)), -1} {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(large))
+		req.ContentLength = length
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Equal(t, "{\"message\":\"request body too large\",\"errors\":null}\n", rec.Body.String())
+	}
+
+	// bodies of media types not validated are not read
+	upload := &countingReader{r: strings.NewReader(strings.Repeat("x", 1024))}
+	req := httptest.NewRequest(http.MethodPost, "/orders", upload)
+	req.Header.Set(gohttp.HeaderContentType, "multipart/form-data; boundary=x")
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, 1, upload.n)
+	assert.Equal(t, `unsupported content type "multipart/form-data"`, validationErrors(t, rec)[0].Message)
+
+	// report-only passes large bodies on whole
+	h = MakeRequestValidatorMiddleware(doc, ValidatorMaxBodySize(64), ValidatorReportOnly(true))(read)
+	req = httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(large))
+	req.ContentLength = -1
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, large, body)
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"context"
+	"time"
+)
+
+// RouteMetadata documents a route. It is attached to a route with Route.Meta
+// of the router packages and read by the openapi package and the
+// middlewares configurable per route.
+type RouteMetadata struct {
+	Summary     string
+	Description string
+	OperationID string
+	Tags        []string
+	Deprecated  bool
+
+	// Request is a value of the request type. Its fields tagged query, path,
+	// header or form are documented as parameters, following the rules of
+	// BindURLQuery; the remaining fields make up the JSON body.
+	Request interface{}
+
+	// Responses maps a status code to a value of the response type. A nil
+	// value documents a response without body.
+	Responses map[int]interface{}
+
+	// Timeout overrides the timeout of the timeout middleware for the route.
+	Timeout time.Duration
+
+	// Streaming marks a route writing its response over time, e.g. server
+	// sent events, which the timeout middleware leaves alone.
+	Streaming bool
+}
+
+type routeMetadataKey struct{}
+
+// ContextWithRouteMetadata returns a copy of ctx carrying the metadata of the
+// route serving the request. The router package sets it before running the
+// middlewares of the route; router/v2 resolves the route before running the
+// middlewares of the Mux, and sets it again once the route is matched, in
+// case they rewrote the request.
+func ContextWithRouteMetadata(ctx context.Context, meta *RouteMetadata) context.Context {
+	return context.WithValue(ctx, routeMetadataKey{}, meta)
+}
+
+// RouteMetadataFromContext returns the metadata of the route serving the
+// request, or nil.
+func RouteMetadataFromContext(ctx context.Context) *RouteMetadata {
+	meta, _ := ctx.Value(routeMetadataKey{}).(*RouteMetadata)
+	return meta
+}
@@ -0,0 +1,56 @@
+package http
+
+import "context"
+
+type routePatternKey struct{}
+
+type matchedRoutePatternKey struct{}
+
+// ContextWithRoutePattern returns a copy of ctx carrying the pattern of the
+// route serving the request, in the syntax of the router. The routers set it
+// once the route is matched, before the middlewares of the route.
+func ContextWithRoutePattern(ctx context.Context, pattern string) context.Context {
+	return context.WithValue(ctx, matchedRoutePatternKey{}, pattern)
+}
+
+// RoutePatternFromContext returns the pattern of the route serving the
+// request, e.g. /users/:id or /users/{id}, or "" before a route is matched.
+func RoutePatternFromContext(ctx context.Context) string {
+	pattern, _ := ctx.Value(matchedRoutePatternKey{}).(string)
+	return pattern
+}
+
+// routePatternRecorder holds the pattern of the route matched down the
+// handler chain, so it can be read once the request is served.
+type routePatternRecorder struct {
+	pattern string
+}
+
+// WithRoutePatternRecorder returns a copy of ctx into which the routers record
+// the pattern of the route they match. Middlewares wrapping a router use it
+// to learn the route of a request after serving it. ctx is returned as is
+// when it already has a recorder, which is then shared.
+func WithRoutePatternRecorder(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(routePatternKey{}).(*routePatternRecorder); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, routePatternKey{}, &routePatternRecorder{})
+}
+
+// RecordRoutePattern records the matched route pattern in ctx, when it has a
+// recorder. Nested routers record the full pattern, replacing the one of the
+// router mounting them.
+func RecordRoutePattern(ctx context.Context, pattern string) {
+	if rec, ok := ctx.Value(routePatternKey{}).(*routePatternRecorder); ok {
+		rec.pattern = pattern
+	}
+}
+
+// RecordedRoutePattern returns the route pattern recorded in ctx, or "" when
+// no route matched or ctx has no recorder.
+func RecordedRoutePattern(ctx context.Context) string {
+	if rec, ok := ctx.Value(routePatternKey{}).(*routePatternRecorder); ok {
+		return rec.pattern
+	}
+	return ""
+}
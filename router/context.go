@@ -3,6 +3,8 @@ package router
 import (
 	"context"
 	"net/http"
+
+	gohttp "github.com/likearthian/go-http"
 )
 
 type contextKey int
@@ -79,6 +81,25 @@ const (
 
 	ContextKeyRequestDatetime
 	ContextKeyRequestSignature
+
+	// ContextKeyHostParams is populated in the context by a Router with
+	// virtual hosts. Its value is of type httprouter.Params and holds the
+	// params captured from r.Host.
+	ContextKeyHostParams
+
+	// ContextKeyAPIVersion is populated in the context by a Router with API
+	// versions. Its value is the version serving the request, of type string.
+	ContextKeyAPIVersion
+
+	// ContextKeyVariant is populated in the context by a route created with
+	// Route.Split. Its value is the name of the variant serving the request,
+	// of type string.
+	ContextKeyVariant
+
+	// ContextKeyRoutePattern is populated in the context by the route
+	// serving the request. Its value is the matched path, in the httprouter
+	// syntax and including the prefix of mounting routers, of type string.
+	ContextKeyRoutePattern
 )
 
 // PopulateRequestContext is a RequestFunc that populates several values into
@@ -109,10 +130,23 @@ func PopulateRequestContextFromHttp(ctx context.Context, r *http.Request) contex
 	return ctx
 }
 
+// ReqIDFromContext returns the request ID set by the request ID middleware,
+// or else the X-Request-Id header populated by PopulateRequestContext.
 func ReqIDFromContext(ctx context.Context) (string, bool) {
+	if reqID, ok := gohttp.RequestIDFromContext(ctx); ok {
+		return reqID, true
+	}
+
 	reqID, ok := ctx.Value(ContextKeyRequestXRequestID).(string)
 	if !ok {
 		return "", false
 	}
 	return reqID, ok
 }
+
+// RoutePatternFromContext returns the path of the matched route, e.g.
+// /api/users/:id, or "" when no route matched.
+func RoutePatternFromContext(ctx context.Context) string {
+	pattern, _ := ctx.Value(ContextKeyRoutePattern).(string)
+	return pattern
+}
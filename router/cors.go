@@ -0,0 +1,378 @@
+package router
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	gohttp "github.com/likearthian/go-http"
+	log "github.com/likearthian/go-logger"
+	"gopkg.in/yaml.v2"
+)
+
+// CORSConfig holds the CORS policy of a router. It can be built with the
+// Cors* options or loaded from YAML with LoadCORSConfig.
+type CORSConfig struct {
+	AllowOrigins []string `yaml:"allow_origins"`
+
+	// AllowOriginPatterns defines regular expressions matched against the
+	// whole request origin, e.g. `https://[a-z0-9-]+\.example\.com`. They
+	// are anchored at both ends.
+	// Optional. Default value []string{}.
+	AllowOriginPatterns []string `yaml:"allow_origin_patterns"`
+
+	// AllowOriginFunc is a custom origin validator. It is consulted after
+	// AllowOrigins and AllowOriginPatterns.
+	// Optional. Default value nil.
+	AllowOriginFunc func(origin string) bool `yaml:"-"`
+
+	// AllowMethods lists the methods allowed by pre-flight requests. GET,
+	// HEAD and POST, the CORS-safelisted methods, are always allowed.
+	// Optional. Default value DefaultCORSConfig.AllowMethods.
+	AllowMethods     string `yaml:"allow_methods"`
+	AllowHeaders     string `yaml:"allow_headers"`
+	AllowCredentials bool   `yaml:"allow_credentials"`
+
+	// AllowPrivateNetwork answers Private Network Access preflights, sent by
+	// browsers when a public site calls a server in a private network.
+	// Optional. Default value false.
+	AllowPrivateNetwork bool `yaml:"allow_private_network"`
+
+	// ExposeHeaders defines a whitelist headers that clients are allowed to
+	// access.
+	// Optional. Default value []string{}.
+	ExposeHeaders string `yaml:"expose_headers"`
+	MaxAge        int    `yaml:"max_age"`
+}
+
+var (
+	// DefaultCORSConfig is the default CORS middleware config.
+	DefaultCORSConfig = CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowMethods: strings.Join([]string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete}, ","),
+	}
+)
+
+type CorsOption func(*CORSConfig)
+
+// corsRule binds a CORS handler to the path prefix of the router that owns
+// it. The most specific prefix wins.
+type corsRule struct {
+	prefix  string
+	handler func(http.Handler) http.Handler
+}
+
+// SetCORSConfig enables CORS on the router. When used on a Subroute it
+// overrides the CORS config of the parent router for that path prefix.
+func SetCORSConfig(options ...CorsOption) RouterOption {
+	config := DefaultCORSConfig
+	return func(r *Router) {
+		for _, op := range options {
+			op(&config)
+		}
+		r.cors = &config
+	}
+}
+
+// ParseCORSConfig parses a YAML document into a CORSConfig. Keys missing from
+// the document keep the values of DefaultCORSConfig.
+func ParseCORSConfig(data []byte) (CORSConfig, error) {
+	config := DefaultCORSConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return CORSConfig{}, fmt.Errorf("failed to parse cors config: %w", err)
+	}
+
+	return config, nil
+}
+
+// LoadCORSConfig reads a YAML file into a CORSConfig.
+func LoadCORSConfig(filename string) (CORSConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return CORSConfig{}, fmt.Errorf("failed to read cors config: %w", err)
+	}
+
+	return ParseCORSConfig(data)
+}
+
+func (rtr *Router) collectCORSRules(rules []corsRule) ([]corsRule, error) {
+	if rtr.cors != nil {
+		handler, err := makeCorsHandler(rtr.cors, rtr.debugLogger)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cors config for prefix %q: %w", rtr.prefix, err)
+		}
+		rules = append(rules, corsRule{prefix: rtr.prefix, handler: handler})
+	}
+
+	var err error
+	for _, rs := range rtr.subRouters {
+		if rules, err = rs.collectCORSRules(rules); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].prefix) > len(rules[j].prefix)
+	})
+
+	return rules, nil
+}
+
+func (rtr *Router) corsHandlerFor(path string) func(http.Handler) http.Handler {
+	for _, rule := range rtr.corsRules {
+		if hasPathPrefix(path, rule.prefix) {
+			return rule.handler
+		}
+	}
+
+	return nil
+}
+
+func makeCorsHandler(config *CORSConfig, debugLogger log.LoggerFunc) (func(http.Handler) http.Handler, error) {
+	allowMethods := config.AllowMethods
+	if strings.TrimSpace(allowMethods) == "" {
+		allowMethods = DefaultCORSConfig.AllowMethods
+	}
+	allowHeaders := config.AllowHeaders
+	exposeHeaders := config.ExposeHeaders
+	maxAge := strconv.Itoa(config.MaxAge)
+
+	// the CORS-safelisted methods need no pre-flight and are always allowed
+	allowedMethods := append(splitHeaderList(allowMethods), http.MethodGet, http.MethodHead, http.MethodPost)
+	allowedHeaders := splitHeaderList(allowHeaders)
+
+	patterns := make([]*regexp.Regexp, 0, len(config.AllowOriginPatterns))
+	for _, p := range config.AllowOriginPatterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid origin pattern %q: %w", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	matchOrigin := func(origin string) string {
+		for _, o := range config.AllowOrigins {
+			if o == "*" && config.AllowCredentials {
+				// the wildcard is not allowed together with credentials,
+				// so the request origin is reflected instead
+				return origin
+			}
+			if o == "*" || o == origin {
+				return o
+			}
+			if matchSubdomain(origin, o) {
+				return origin
+			}
+		}
+		for _, re := range patterns {
+			if re.MatchString(origin) {
+				return origin
+			}
+		}
+		if config.AllowOriginFunc != nil && config.AllowOriginFunc(origin) {
+			return origin
+		}
+		return ""
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get(gohttp.HeaderOrigin)
+			preflight := r.Method == http.MethodOptions && r.Header.Get(gohttp.HeaderAccessControlRequestMethod) != ""
+
+			w.Header().Add(gohttp.HeaderVary, gohttp.HeaderOrigin)
+
+			// Not a CORS request
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowOrigin := matchOrigin(origin)
+			_ = debugLogger("event", "cors handler", "msg", fmt.Sprintf("set %s: %s", gohttp.HeaderAccessControlAllowOrigin, allowOrigin))
+
+			if !preflight {
+				if allowOrigin != "" {
+					w.Header().Set(gohttp.HeaderAccessControlAllowOrigin, allowOrigin)
+					if config.AllowCredentials {
+						w.Header().Set(gohttp.HeaderAccessControlAllowCredentials, "true")
+					}
+					if exposeHeaders != "" {
+						w.Header().Set(gohttp.HeaderAccessControlExposeHeaders, exposeHeaders)
+					}
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Handling pre-flight request
+			_ = debugLogger("event", "cors handler", "msg", "handling pre-fligt request")
+			w.Header().Add(gohttp.HeaderVary, gohttp.HeaderAccessControlRequestMethod)
+			w.Header().Add(gohttp.HeaderVary, gohttp.HeaderAccessControlRequestHeaders)
+
+			if allowOrigin == "" {
+				rejectPreflight(w, debugLogger, "origin not allowed", origin)
+				return
+			}
+
+			reqMethod := r.Header.Get(gohttp.HeaderAccessControlRequestMethod)
+			if !containsFold(allowedMethods, reqMethod) {
+				rejectPreflight(w, debugLogger, "method not allowed", reqMethod)
+				return
+			}
+
+			reqHeaders := r.Header.Get(gohttp.HeaderAccessControlRequestHeaders)
+			if allowHeaders != "" {
+				for _, h := range splitHeaderList(reqHeaders) {
+					if !containsFold(allowedHeaders, h) {
+						rejectPreflight(w, debugLogger, "header not allowed", h)
+						return
+					}
+				}
+			}
+
+			w.Header().Set(gohttp.HeaderAccessControlAllowOrigin, allowOrigin)
+			w.Header().Set(gohttp.HeaderAccessControlAllowMethods, allowMethods)
+
+			if config.AllowCredentials {
+				w.Header().Set(gohttp.HeaderAccessControlAllowCredentials, "true")
+			}
+
+			if allowHeaders != "" {
+				w.Header().Set(gohttp.HeaderAccessControlAllowHeaders, allowHeaders)
+			} else if reqHeaders != "" {
+				w.Header().Set(gohttp.HeaderAccessControlAllowHeaders, reqHeaders)
+			}
+
+			if config.AllowPrivateNetwork && r.Header.Get(gohttp.HeaderAccessControlRequestPrivateNetwork) == "true" {
+				w.Header().Set(gohttp.HeaderAccessControlAllowPrivateNetwork, "true")
+			}
+
+			if config.MaxAge > 0 {
+				w.Header().Set(gohttp.HeaderAccessControlMaxAge, maxAge)
+			}
+
+			_ = debugLogger("event", "cors handler", "msg", "set header for pre-flight request", "header", w.Header())
+			w.WriteHeader(http.StatusOK)
+		})
+	}, nil
+}
+
+// rejectPreflight answers a disallowed pre-flight request without any
+// Access-Control-Allow-* header, so the browser blocks the actual request.
+func rejectPreflight(w http.ResponseWriter, debugLogger log.LoggerFunc, reason, value string) {
+	_ = debugLogger("event", "cors handler", "msg", "pre-flight request rejected", "reason", reason, "value", value)
+	w.WriteHeader(http.StatusForbidden)
+}
+
+func splitHeaderList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// CorsFromConfig replaces the whole config, e.g. with one loaded by
+// LoadCORSConfig. Options given after it still apply on top.
+func CorsFromConfig(cfg CORSConfig) CorsOption {
+	return func(config *CORSConfig) {
+		*config = cfg
+	}
+}
+
+// CorsAllowOrigin defines a list of origins that may access the resource.
+// Optional. Default value []string{"*"}.
+func CorsAllowOrigin(origins []string) CorsOption {
+	return func(config *CORSConfig) {
+		if len(origins) > 0 {
+			config.AllowOrigins = origins
+		}
+	}
+}
+
+// CorsAllowOriginPatterns defines regular expressions an origin may match to
+// access the resource.
+// Optional. Default value []string{}.
+func CorsAllowOriginPatterns(patterns []string) CorsOption {
+	return func(config *CORSConfig) {
+		config.AllowOriginPatterns = patterns
+	}
+}
+
+// CorsAllowOriginFunc defines a custom function to validate the origin. It is
+// called only when the origin did not match AllowOrigins or
+// AllowOriginPatterns.
+// Optional. Default value nil.
+func CorsAllowOriginFunc(fn func(origin string) bool) CorsOption {
+	return func(config *CORSConfig) {
+		config.AllowOriginFunc = fn
+	}
+}
+
+// CorsAllowMethods defines a list methods allowed when accessing the resource.
+// This is used in response to a preflight request.
+// Optional. Default value DefaultCORSConfig.AllowMethods.
+func CorsAllowMethods(methods []string) CorsOption {
+	return func(config *CORSConfig) {
+		if len(methods) > 0 {
+			config.AllowMethods = strings.Join(methods, ",")
+		}
+	}
+}
+
+// CorsAllowHeaders defines a list of request headers that can be used when
+// making the actual request. This is in response to a preflight request.
+// Optional. Default value []string{}.
+func CorsAllowHeaders(headers []string) CorsOption {
+	return func(config *CORSConfig) {
+		if len(headers) > 0 {
+			config.AllowHeaders = strings.Join(headers, ",")
+		}
+	}
+}
+
+// CorsAllowCredentials indicates whether or not the response to the request
+// can be exposed when the credentials flag is true. When used as part of
+// a response to a preflight request, this indicates whether or not the
+// actual request can be made using credentials.
+// Optional. Default value false.
+func CorsAllowCredentials(allowCredential bool) CorsOption {
+	return func(config *CORSConfig) {
+		config.AllowCredentials = allowCredential
+	}
+}
+
+// CorsAllowPrivateNetwork indicates whether or not pre-flight requests
+// carrying Access-Control-Request-Private-Network are allowed.
+// Optional. Default value false.
+func CorsAllowPrivateNetwork(allow bool) CorsOption {
+	return func(config *CORSConfig) {
+		config.AllowPrivateNetwork = allow
+	}
+}
+
+// CorsMaxAge indicates how long (in seconds) the results of a preflight request
+// can be cached.
+// Optional. Default value 0.
+func CorsMaxAge(maxAge int) CorsOption {
+	return func(config *CORSConfig) {
+		config.MaxAge = maxAge
+	}
+}
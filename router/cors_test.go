@@ -0,0 +1,187 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/tj/assert"
+)
+
+func newCORSTestRouter(options ...RouterOption) *Router {
+	rtr := NewRouter(options...)
+	rtr.Methods(http.MethodGet, http.MethodPost).Handler("/items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	return rtr
+}
+
+func preflight(origin, method string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, "/items", nil)
+	req.Header.Set(gohttp.HeaderOrigin, origin)
+	req.Header.Set(gohttp.HeaderAccessControlRequestMethod, method)
+	return req
+}
+
+func TestCORSWildcardWithCredentials(t *testing.T) {
+	rtr := newCORSTestRouter(SetCORSConfig(CorsAllowCredentials(true)))
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set(gohttp.HeaderOrigin, "https://app.example.com")
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get(gohttp.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, "true", rec.Header().Get(gohttp.HeaderAccessControlAllowCredentials))
+	assert.Contains(t, rec.Header().Values(gohttp.HeaderVary), gohttp.HeaderOrigin)
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, preflight("https://other.example.org", http.MethodPost))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://other.example.org", rec.Header().Get(gohttp.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, "true", rec.Header().Get(gohttp.HeaderAccessControlAllowCredentials))
+}
+
+func TestCORSWildcardWithoutCredentials(t *testing.T) {
+	rtr := newCORSTestRouter(SetCORSConfig())
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, preflight("https://app.example.com", http.MethodGet))
+
+	assert.Equal(t, "*", rec.Header().Get(gohttp.HeaderAccessControlAllowOrigin))
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderAccessControlAllowCredentials))
+}
+
+func TestCORSRejectPreflight(t *testing.T) {
+	rtr := newCORSTestRouter(SetCORSConfig(
+		CorsAllowOrigin([]string{"https://app.example.com"}),
+		CorsAllowMethods([]string{http.MethodGet}),
+		CorsAllowHeaders([]string{"Content-Type"}),
+	))
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, preflight("https://evil.example.com", http.MethodGet))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderAccessControlAllowOrigin))
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, preflight("https://app.example.com", http.MethodDelete))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// the CORS-safelisted methods are always allowed
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, preflight("https://app.example.com", http.MethodPost))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req := preflight("https://app.example.com", http.MethodGet)
+	req.Header.Set(gohttp.HeaderAccessControlRequestHeaders, "content-type, x-secret")
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req = preflight("https://app.example.com", http.MethodGet)
+	req.Header.Set(gohttp.HeaderAccessControlRequestHeaders, "content-type")
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get(gohttp.HeaderAccessControlAllowOrigin))
+}
+
+func TestCORSEmptyAllowMethods(t *testing.T) {
+	rtr := newCORSTestRouter(SetCORSConfig(CorsFromConfig(CORSConfig{AllowOrigins: []string{"*"}})))
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, preflight("https://app.example.com", http.MethodDelete))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, DefaultCORSConfig.AllowMethods, rec.Header().Get(gohttp.HeaderAccessControlAllowMethods))
+}
+
+func TestCORSOriginValidators(t *testing.T) {
+	rtr := newCORSTestRouter(SetCORSConfig(
+		CorsAllowOrigin([]string{"https://app.example.com"}),
+		CorsAllowOriginPatterns([]string{`^https://[a-z0-9-]+\.preview\.example\.com$`, `https://.*\.staging\.example\.com`}),
+		CorsAllowOriginFunc(func(origin string) bool {
+			return strings.HasSuffix(origin, ".partner.com")
+		}),
+	))
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://pr-12.preview.example.com", true},
+		{"https://pr-12.preview.example.com.evil.com", false},
+		{"https://a.staging.example.com", true},
+		{"https://a.staging.example.com.evil.com", false},
+		{"http://evil.com/https://a.staging.example.com", false},
+		{"https://acme.partner.com", true},
+		{"https://example.org", false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/items", nil)
+		req.Header.Set(gohttp.HeaderOrigin, test.origin)
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, req)
+
+		if test.allowed {
+			assert.Equal(t, test.origin, rec.Header().Get(gohttp.HeaderAccessControlAllowOrigin), test.origin)
+		} else {
+			assert.Empty(t, rec.Header().Get(gohttp.HeaderAccessControlAllowOrigin), test.origin)
+		}
+	}
+}
+
+func TestCORSPrivateNetwork(t *testing.T) {
+	rtr := newCORSTestRouter(SetCORSConfig(CorsAllowPrivateNetwork(true)))
+
+	req := preflight("https://app.example.com", http.MethodGet)
+	req.Header.Set(gohttp.HeaderAccessControlRequestPrivateNetwork, "true")
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, req)
+
+	assert.Equal(t, "true", rec.Header().Get(gohttp.HeaderAccessControlAllowPrivateNetwork))
+}
+
+func TestCORSSubrouteOverride(t *testing.T) {
+	rtr := newCORSTestRouter(SetCORSConfig())
+	admin := rtr.Subroute("/admin", SetCORSConfig(CorsAllowOrigin([]string{"https://admin.example.com"})))
+	admin.Methods(http.MethodGet).Handler("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+	req.Header.Set(gohttp.HeaderOrigin, "https://app.example.com")
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, req)
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderAccessControlAllowOrigin))
+
+	req = httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set(gohttp.HeaderOrigin, "https://app.example.com")
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, req)
+	assert.Equal(t, "*", rec.Header().Get(gohttp.HeaderAccessControlAllowOrigin))
+}
+
+func TestParseCORSConfig(t *testing.T) {
+	data := []byte(`
+allow_origins:
+  - https://app.example.com
+allow_origin_patterns:
+  - ^https://.*\.example\.com$
+allow_credentials: true
+allow_private_network: true
+max_age: 600
+`)
+
+	config, err := ParseCORSConfig(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://app.example.com"}, config.AllowOrigins)
+	assert.Equal(t, []string{`^https://.*\.example\.com$`}, config.AllowOriginPatterns)
+	assert.Equal(t, DefaultCORSConfig.AllowMethods, config.AllowMethods)
+	assert.True(t, config.AllowCredentials)
+	assert.True(t, config.AllowPrivateNetwork)
+	assert.Equal(t, 600, config.MaxAge)
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+// initAutoHead registers a HEAD route for every GET route of the routing tree
+// that has no HEAD route on the same path, through any Methods call.
+func (rtr *Router) initAutoHead() error {
+	var gets []*Route
+	heads := map[string]bool{}
+	rtr.eachTreeRoute(func(r *Route) {
+		for _, m := range r.methods {
+			switch m {
+			case http.MethodGet:
+				gets = append(gets, r)
+			case http.MethodHead:
+				heads[r.router.prefix+r.path] = true
+			}
+		}
+	})
+
+	for _, r := range gets {
+		path := r.router.prefix + r.path
+		if heads[path] {
+			continue
+		}
+		heads[path] = true
+
+		if err := r.router.handle(http.MethodHead, path, withRouteMetadata(r.meta, r.router.wrapMiddlewares(headHandler(r.handler)))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eachTreeRoute calls fn for the routes of rtr and of its sub routers, which
+// share its routing tree.
+func (rtr *Router) eachTreeRoute(fn func(*Route)) {
+	for _, r := range rtr.routes {
+		fn(r)
+	}
+	for _, rs := range rtr.subRouters {
+		rs.eachTreeRoute(fn)
+	}
+}
+
+// eachTreeRouter calls fn for rtr and its sub routers, which share its
+// routing tree.
+func (rtr *Router) eachTreeRouter(fn func(*Router)) {
+	fn(rtr)
+	for _, rs := range rtr.subRouters {
+		rs.eachTreeRouter(fn)
+	}
+}
+
+// headHandler serves a HEAD request with the GET handler, discarding the body
+// it writes. The Content-Length of the GET response is kept, computed from
+// the discarded body when the handler does not set it.
+func headHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hw := &headResponseWriter{ResponseWriter: w}
+		handler.ServeHTTP(hw, r)
+		hw.finish()
+	})
+}
+
+type headResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *headResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written += int64(len(b))
+	return len(b), nil
+}
+
+func (w *headResponseWriter) finish() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	h := w.Header()
+	if h.Get(gohttp.HeaderContentLength) == "" && w.written > 0 {
+		h.Set(gohttp.HeaderContentLength, strconv.FormatInt(w.written, 10))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// answerOptions replies to an OPTIONS request on a path without an OPTIONS
+// route; the Allow header is set by the routing tree before it is called.
+func answerOptions(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,155 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// hostRoute is a virtual host served by its own routing tree.
+type hostRoute struct {
+	pattern string
+	labels  []string
+	params  bool
+	router  *Router
+}
+
+// Host creates a router that only serves requests whose Host matches
+// pattern. A pattern is either an exact host name ("admin.example.com") or
+// contains whole-label parameters ("{tenant}.example.com"). When the pattern
+// carries no port, the port of the request is ignored.
+//
+// Exact hosts are tried before parameterized ones, which are tried in
+// registration order. Requests matching no host fall back to the routes of
+// rtr itself. The host router inherits the middlewares and CORS config of
+// rtr; options apply to the host router only.
+//
+// Host must be called on the router that serves the requests, or on a router
+// it mounts; Build fails for hosts of a Subroute.
+func (rtr *Router) Host(pattern string, options ...RouterOption) *Router {
+	router := &Router{
+		router:      httprouter.New(),
+		prefix:      rtr.prefix,
+		hostname:    pattern,
+		middlewares: []MiddlewareFunc{},
+		routes:      []*Route{},
+		subRouters:  []*Router{},
+		isInit:      false,
+		cors:        rtr.cors,
+		debugLogger: rtr.debugLogger,
+	}
+
+	for _, op := range options {
+		op(router)
+	}
+
+	pattern = strings.ToLower(pattern)
+	labels := strings.Split(pattern, ".")
+	hasParams := false
+	for _, l := range labels {
+		if isHostParam(l) {
+			hasParams = true
+		}
+	}
+
+	rtr.hosts = append(rtr.hosts, &hostRoute{
+		pattern: pattern,
+		labels:  labels,
+		params:  hasParams,
+		router:  router,
+	})
+
+	return router
+}
+
+func (rtr *Router) initHosts() error {
+	for _, h := range rtr.hosts {
+		var middlewares []MiddlewareFunc
+		middlewares = append(middlewares, rtr.middlewares...)
+		middlewares = append(middlewares, h.router.middlewares...)
+
+		h.router.middlewares = middlewares
+		if err := h.router.Build(); err != nil {
+			return fmt.Errorf("host %s: %w", h.pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// matchHost returns the host router serving host, along with the captured
+// host params.
+func (rtr *Router) matchHost(host string) (*Router, httprouter.Params) {
+	if len(rtr.hosts) == 0 {
+		return nil, nil
+	}
+
+	host = strings.ToLower(host)
+	hostOnly := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostOnly = h
+	}
+
+	for _, h := range rtr.hosts {
+		if h.params {
+			continue
+		}
+		if h.pattern == host || h.pattern == hostOnly {
+			return h.router, nil
+		}
+	}
+
+	for _, h := range rtr.hosts {
+		if !h.params {
+			continue
+		}
+
+		candidate := hostOnly
+		if strings.Contains(h.pattern, ":") {
+			candidate = host
+		}
+
+		if params, ok := h.match(candidate); ok {
+			return h.router, params
+		}
+	}
+
+	return nil, nil
+}
+
+func (h *hostRoute) match(host string) (httprouter.Params, bool) {
+	labels := strings.Split(host, ".")
+	if len(labels) != len(h.labels) {
+		return nil, false
+	}
+
+	var params httprouter.Params
+	for i, l := range h.labels {
+		if isHostParam(l) {
+			if labels[i] == "" {
+				return nil, false
+			}
+			params = append(params, httprouter.Param{Key: l[1 : len(l)-1], Value: labels[i]})
+			continue
+		}
+		if l != labels[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func isHostParam(label string) bool {
+	return len(label) > 2 && strings.HasPrefix(label, "{") && strings.HasSuffix(label, "}")
+}
+
+// HostParamsFromContext returns the params captured from the Host of the
+// request by a router created with Router.Host.
+func HostParamsFromContext(ctx context.Context) httprouter.Params {
+	params, _ := ctx.Value(ContextKeyHostParams).(httprouter.Params)
+	return params
+}
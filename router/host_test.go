@@ -0,0 +1,67 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestHostRouting(t *testing.T) {
+	writeParams := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := GetParamsFromContext(r.Context())
+		_, _ = io.WriteString(w, params.ByName("tenant")+"/"+params.ByName("id"))
+	})
+
+	rtr := NewRouter()
+	rtr.Methods(http.MethodGet).Handler("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "default")
+	}))
+
+	admin := rtr.Host("admin.example.com")
+	admin.Methods(http.MethodGet).Handler("/users/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "admin")
+	}))
+
+	tenant := rtr.Host("{tenant}.example.com")
+	tenant.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Tenant", HostParamsFromContext(r.Context()).ByName("tenant"))
+			next.ServeHTTP(w, r)
+		})
+	})
+	tenant.Methods(http.MethodGet).Handler("/users/:id", writeParams)
+
+	tests := []struct {
+		host   string
+		body   string
+		tenant string
+	}{
+		{"admin.example.com", "admin", ""},
+		{"ADMIN.example.com:8080", "admin", ""},
+		{"acme.example.com", "acme/42", "acme"},
+		{"acme.eu.example.com", "default", ""},
+		{"localhost:8080", "default", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		req.Host = test.host
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, test.host)
+		assert.Equal(t, test.body, rec.Body.String(), test.host)
+		assert.Equal(t, test.tenant, rec.Header().Get("X-Tenant"), test.host)
+	}
+}
+
+func TestHostOnSubroute(t *testing.T) {
+	rtr := NewRouter()
+	api := rtr.Subroute("/api")
+	api.Host("admin.example.com").Methods(http.MethodGet).Handler("/users", http.NotFoundHandler())
+
+	assert.EqualError(t, rtr.Build(), "host admin.example.com: Host is not supported on the sub router /api")
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const mountPathParam = "mountpath"
+
+// mountMethods are the methods forwarded to a mounted handler.
+var mountMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodConnect,
+	http.MethodTrace,
+}
+
+// Mount forwards every request under prefix to handler, with the prefix
+// stripped from r.URL.Path. The middlewares of rtr run before handler. Routes
+// registered elsewhere under the same prefix are reported as a conflict by
+// Build. An empty prefix mounts handler for every path under the prefix of
+// rtr not matched by another route.
+func (rtr *Router) Mount(prefix string, handler http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		rtr.setFallback(handler, nil, rtr.prefix+"/*"+mountPathParam)
+		return
+	}
+
+	mounted := stripMountPrefix(prefix, handler)
+	child, _ := handler.(*Router)
+	for _, path := range []string{prefix, prefix + "/*" + mountPathParam} {
+		rt := rtr.Methods(mountMethods...)
+		rt.mountPrefix = prefix
+		rt.mounted = child
+		rt.Handler(path, mounted)
+	}
+}
+
+// MountRouter mounts an independently built router under prefix. The
+// middlewares of rtr run before the ones of router, and router matches its
+// routes against the path with the prefix stripped. router is built together
+// with rtr, so its own conflicts are reported by the Build of rtr.
+func (rtr *Router) MountRouter(prefix string, router *Router) {
+	rtr.mounts = append(rtr.mounts, router)
+	rtr.Mount(prefix, router)
+}
+
+// fallbackRoute serves the requests matching no route under the prefix of
+// the router it is set on.
+type fallbackRoute struct {
+	prefix  string
+	methods []string
+	handler http.Handler
+	// pattern is the route pattern of the requests it serves
+	pattern string
+}
+
+// setFallback sets the handler of the requests matching no route under the
+// prefix of rtr, for methods or every method when nil, served as the route
+// pattern. A router has a single fallback, setting another one is reported
+// by Build.
+func (rtr *Router) setFallback(handler http.Handler, methods []string, pattern string) {
+	if rtr.fallback != nil {
+		prefix := rtr.prefix
+		if prefix == "" {
+			prefix = "/"
+		}
+		rtr.fallbackErr = fmt.Errorf("fallback conflict for %s%s: a fallback handler is already set by Mount or Static", rtr.hostname, prefix)
+		return
+	}
+	rtr.fallback = &fallbackRoute{prefix: rtr.prefix, methods: methods, handler: handler, pattern: pattern}
+}
+
+// initFallbacks installs the fallbacks of rtr and of its sub routers as the
+// NotFound handler of their routing tree. A request is served by the
+// fallback with the longest prefix of its path allowing its method.
+func (rtr *Router) initFallbacks() {
+	var fallbacks []*fallbackRoute
+	rtr.eachTreeRouter(func(r *Router) {
+		if r.fallback != nil {
+			f := *r.fallback
+			f.handler = withRoutePattern(f.pattern, r.wrapMiddlewares(f.handler))
+			fallbacks = append(fallbacks, &f)
+		}
+	})
+	if len(fallbacks) == 0 {
+		return
+	}
+	sort.SliceStable(fallbacks, func(i, j int) bool { return len(fallbacks[i].prefix) > len(fallbacks[j].prefix) })
+
+	rtr.router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, f := range fallbacks {
+			if f.prefix != "" && r.URL.Path != f.prefix && !strings.HasPrefix(r.URL.Path, f.prefix+"/") {
+				continue
+			}
+			if f.methods != nil && !containsMethod(f.methods, r.Method) {
+				continue
+			}
+			f.handler.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+func stripMountPrefix(prefix string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := httprouter.ParamsFromContext(r.Context()).ByName(mountPathParam)
+		if p == "" {
+			p = "/"
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		r2.URL.RawPath = ""
+
+		handler.ServeHTTP(w, r2)
+	})
+}
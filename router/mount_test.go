@@ -0,0 +1,91 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/tj/assert"
+)
+
+func headerMiddleware(value string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Chain", value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMount(t *testing.T) {
+	rtr := NewRouter()
+	rtr.Use(headerMiddleware("root"))
+	rtr.Mount("/debug", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Method+" "+r.URL.Path)
+	}))
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/pprof/profile?seconds=1", nil))
+	assert.Equal(t, "POST /pprof/profile", rec.Body.String())
+	assert.Equal(t, []string{"root"}, rec.Header().Values("X-Chain"))
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug", nil))
+	assert.Equal(t, "GET /", rec.Body.String())
+}
+
+func TestMountRouter(t *testing.T) {
+	billing := NewRouter()
+	billing.Use(headerMiddleware("billing"))
+	billing.Methods(http.MethodGet).Handler("/invoices/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "invoice "+GetParamsFromContext(r.Context()).ByName("id"))
+	}))
+
+	rtr := NewRouter()
+	rtr.Use(headerMiddleware("root"))
+	api := rtr.Subroute("/api")
+	api.Use(headerMiddleware("api"))
+	api.MountRouter("/billing", billing)
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/billing/invoices/7", nil))
+	assert.Equal(t, "invoice 7", rec.Body.String())
+	assert.Equal(t, []string{"root", "api", "billing"}, rec.Header().Values("X-Chain"))
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/billing/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestMountConflict(t *testing.T) {
+	rtr := NewRouter()
+	rtr.Methods(http.MethodGet).Handler("/debug/vars", http.NotFoundHandler())
+	rtr.Mount("/debug", http.NotFoundHandler())
+
+	err := rtr.Build()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "route conflict")
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestMountRoutePattern(t *testing.T) {
+	billing := NewRouter()
+	billing.Methods(http.MethodGet).Handler("/invoices/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, RoutePatternFromContext(r.Context()))
+	}))
+
+	rtr := NewRouter()
+	rtr.Subroute("/api").MountRouter("/billing", billing)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/billing/invoices/7", nil)
+	ctx := gohttp.WithRoutePatternRecorder(req.Context())
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, req.WithContext(ctx))
+	assert.Equal(t, "/api/billing/invoices/:id", rec.Body.String())
+	assert.Equal(t, "/api/billing/invoices/:id", gohttp.RecordedRoutePattern(ctx))
+}
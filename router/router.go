@@ -4,8 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/julienschmidt/httprouter"
 	gohttp "github.com/likearthian/go-http"
@@ -17,11 +17,25 @@ type MiddlewareFunc func(next http.Handler) http.Handler
 type Router struct {
 	router      *httprouter.Router
 	isInit      bool
+	buildOnce   sync.Once
+	buildErr    error
 	prefix      string
+	hostname    string
 	middlewares []MiddlewareFunc
+	preRouting  []MiddlewareFunc
+	// dispatch routes requests, wrapped in the pre-routing middlewares
+	dispatch    http.Handler
 	routes      []*Route
 	subRouters  []*Router
-	cors        *corsConfig
+	hosts       []*hostRoute
+	fallback    *fallbackRoute
+	fallbackErr error
+	mounts      []*Router
+	cors        *CORSConfig
+	corsRules   []corsRule
+	versions    []*versionRoute
+	versioning  *versioning
+	runtime     *runtimeTable
 	debugLogger log.LoggerFunc
 }
 
@@ -30,31 +44,27 @@ type Route struct {
 	path    string
 	methods []string
 	handler http.Handler
+	meta    *gohttp.RouteMetadata
+	// err is an invalid configuration of the route, reported by Build
+	err error
+
+	// mountPrefix is set on the routes registered by Mount, so they are not
+	// listed by Routes.
+	mountPrefix string
+	mounted     *Router
 }
 
-type corsConfig struct {
-	AllowOrigins     []string `yaml:"allow_origins"`
-	AllowMethods     string   `yaml:"allow_methods"`
-	AllowHeaders     string   `yaml:"allow_headers"`
-	AllowCredentials bool     `yaml:"allow_credentials"`
-
-	// ExposeHeaders defines a whitelist headers that clients are allowed to
-	// access.
-	// Optional. Default value []string{}.
-	ExposeHeaders string `yaml:"expose_headers"`
-	MaxAge        int    `yaml:"max_age"`
-	MaxAgeStr     string
+// RouteInfo describes a registered route. Path uses the httprouter syntax,
+// e.g. /users/:id. Routes of an API version resolved by path are listed with
+// their version prefix.
+type RouteInfo struct {
+	Methods  []string
+	Host     string
+	Path     string
+	Version  string
+	Metadata *gohttp.RouteMetadata
 }
 
-var (
-	// DefaultCORSConfig is the default CORS middleware config.
-	DefaultCORSConfig = corsConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: strings.Join([]string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete}, ","),
-	}
-)
-
-type CorsOption func(*corsConfig)
 type RouterOption func(*Router)
 
 func NewRouter(options ...RouterOption) *Router {
@@ -74,16 +84,6 @@ func NewRouter(options ...RouterOption) *Router {
 	return router
 }
 
-func SetCORSConfig(options ...CorsOption) RouterOption {
-	config := DefaultCORSConfig
-	return func(r *Router) {
-		for _, op := range options {
-			op(&config)
-		}
-		r.cors = &config
-	}
-}
-
 func SetDebugLogger(debugLogger log.LoggerFunc) RouterOption {
 	return func(r *Router) {
 		if debugLogger != nil {
@@ -96,7 +96,18 @@ func (rtr *Router) Use(middlewares ...MiddlewareFunc) {
 	rtr.middlewares = append(rtr.middlewares, middlewares...)
 }
 
-func (rtr *Router) Subroute(pathPrefix string) *Router {
+// UsePreRouting adds middlewares that run before the route is looked up, so
+// they may rewrite the method or path the request is routed by. They wrap
+// every request served by rtr, including the ones matching no route, and
+// run before the middlewares added with Use.
+func (rtr *Router) UsePreRouting(middlewares ...MiddlewareFunc) {
+	rtr.preRouting = append(rtr.preRouting, middlewares...)
+}
+
+// Subroute creates a child router for pathPrefix. The child shares the
+// routing tree of its parent and inherits its middlewares. Options such as
+// SetCORSConfig apply to the child only.
+func (rtr *Router) Subroute(pathPrefix string, options ...RouterOption) *Router {
 	router := Router{
 		prefix:      rtr.prefix + pathPrefix,
 		router:      rtr.router,
@@ -104,6 +115,14 @@ func (rtr *Router) Subroute(pathPrefix string) *Router {
 		routes:      []*Route{},
 		subRouters:  []*Router{},
 		isInit:      false,
+		debugLogger: rtr.debugLogger,
+	}
+
+	for _, op := range options {
+		op(&router)
+	}
+	if router.runtime != nil {
+		router.runtime.err = fmt.Errorf("%w: %s", ErrRuntimeRoutesSubrouter, router.prefix)
 	}
 
 	rtr.subRouters = append(rtr.subRouters, &router)
@@ -127,41 +146,169 @@ func (rt *Route) Handler(path string, handler http.Handler) {
 	rt.path = path
 }
 
+// Meta attaches documentation metadata to the route.
+func (rt *Route) Meta(meta gohttp.RouteMetadata) *Route {
+	rt.meta = &meta
+	return rt
+}
+
+// Routes lists the routes of the router tree, including the ones of sub,
+// host and mounted routers, in registration order.
+func (rtr *Router) Routes() []RouteInfo {
+	return rtr.collectRoutes(nil, "", rtr.hostname, "")
+}
+
+func (rtr *Router) collectRoutes(routes []RouteInfo, mountPrefix, host, version string) []RouteInfo {
+	for _, r := range rtr.routes {
+		if r.mountPrefix != "" {
+			if r.mounted != nil && r.path == r.mountPrefix {
+				routes = r.mounted.collectRoutes(routes, mountPrefix+rtr.prefix+r.path, host, version)
+			}
+			continue
+		}
+
+		routes = append(routes, RouteInfo{
+			Methods:  r.methods,
+			Host:     host,
+			Path:     mountPrefix + rtr.prefix + r.path,
+			Version:  version,
+			Metadata: r.meta,
+		})
+	}
+	routes = rtr.runtimeRouteInfos(routes, mountPrefix, host, version)
+
+	for _, rs := range rtr.subRouters {
+		routes = rs.collectRoutes(routes, mountPrefix, host, version)
+	}
+
+	for _, h := range rtr.hosts {
+		routes = h.router.collectRoutes(routes, mountPrefix, h.router.hostname, version)
+	}
+
+	for _, v := range rtr.versions {
+		prefix := mountPrefix
+		if rtr.versioning != nil && rtr.versioning.byPath {
+			prefix += "/v" + v.name
+		}
+		routes = v.router.collectRoutes(routes, prefix, host, v.name)
+	}
+
+	return routes
+}
+
 func (rtr *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if !rtr.isInit {
-		if err := rtr.initRoutes(); err != nil {
-			return
+	if err := rtr.Build(); err != nil {
+		_ = rtr.debugLogger("event", "router build", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	rtr.dispatch.ServeHTTP(w, r)
+}
+
+// route serves r by the host, version or route it matches.
+func (rtr *Router) route(w http.ResponseWriter, r *http.Request) {
+	if host, params := rtr.matchHost(r.Host); host != nil {
+		if len(params) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), ContextKeyHostParams, params))
 		}
+		host.ServeHTTP(w, r)
+		return
+	}
+
+	if rtr.serveVersion(w, r) {
+		return
 	}
 
 	var s http.Handler = rtr.router
-	if rtr.cors != nil {
-		corsHandler := makeCorsHandler(rtr.cors, rtr.debugLogger)
+	if tree := rtr.runtimeTree(); tree != nil {
+		s = tree
+	}
+	if corsHandler := rtr.corsHandlerFor(r.URL.Path); corsHandler != nil {
 		s = corsHandler(s)
 	}
 
 	s.ServeHTTP(w, r)
 }
 
+// Build registers all routes of the router tree. It is called by the first
+// request or by Run; calling it earlier reports route conflicts and invalid
+// configuration at startup. Only the first call builds the router.
+func (rtr *Router) Build() error {
+	rtr.buildOnce.Do(func() {
+		rtr.buildErr = rtr.build()
+	})
+	return rtr.buildErr
+}
+
+// build registers all routes of the router tree and prepares the handlers
+// resolved per request by the root router.
+func (rtr *Router) build() error {
+	if err := rtr.initRoutes(); err != nil {
+		return err
+	}
+
+	if err := rtr.initAutoHead(); err != nil {
+		return err
+	}
+	rtr.initFallbacks()
+	rtr.router.HandleOPTIONS = true
+	rtr.router.GlobalOPTIONS = rtr.wrapMiddlewares(http.HandlerFunc(answerOptions))
+
+	if err := rtr.initHosts(); err != nil {
+		return err
+	}
+
+	if err := rtr.initVersions(); err != nil {
+		return err
+	}
+
+	rules, err := rtr.collectCORSRules(nil)
+	if err != nil {
+		return err
+	}
+	rtr.corsRules = rules
+
+	var dispatch http.Handler = http.HandlerFunc(rtr.route)
+	for i := len(rtr.preRouting) - 1; i >= 0; i-- {
+		dispatch = rtr.preRouting[i](dispatch)
+	}
+	rtr.dispatch = dispatch
+
+	return nil
+}
+
 func (rtr *Router) initRoutes() error {
 	for _, r := range rtr.routes {
 		prefixedPath := r.router.prefix + r.path
-		fmt.Printf("adding route for %v - %s\n", r.methods, prefixedPath)
+		_ = rtr.debugLogger("event", "route registered", "methods", r.methods, "path", r.router.hostname+prefixedPath)
+		if r.err != nil {
+			return r.err
+		}
 		for _, m := range r.methods {
 			if r.handler == nil {
 				return fmt.Errorf("no handler for path %s", prefixedPath)
 			}
 
-			handler := r.handler
-			t := len(r.router.middlewares)
-			for i := t - 1; i >= 0; i-- {
-				handler = r.router.middlewares[i](handler)
+			if err := r.router.handle(m, prefixedPath, withRouteMetadata(r.meta, r.router.wrapMiddlewares(r.handler))); err != nil {
+				return err
 			}
+		}
+	}
 
-			r.router.router.Handler(m, prefixedPath, handler)
+	for _, m := range rtr.mounts {
+		if err := m.Build(); err != nil {
+			return fmt.Errorf("mounted router: %w", err)
 		}
 	}
 
+	if rtr.fallbackErr != nil {
+		return rtr.fallbackErr
+	}
+	if rtr.runtime != nil && rtr.runtime.err != nil {
+		return rtr.runtime.err
+	}
+
 	rtr.isInit = true
 
 	for _, rs := range rtr.subRouters {
@@ -170,6 +317,10 @@ func (rtr *Router) initRoutes() error {
 		middlewares = append(middlewares, rs.middlewares...)
 
 		rs.middlewares = middlewares
+		rs.hostname = rtr.hostname
+		if len(rs.hosts) > 0 {
+			return fmt.Errorf("host %s: Host is not supported on the sub router %s", rs.hosts[0].pattern, rs.prefix)
+		}
 		if err := rs.initRoutes(); err != nil {
 			return err
 		}
@@ -178,141 +329,68 @@ func (rtr *Router) initRoutes() error {
 	return nil
 }
 
-func (rtr *Router) Run(address string) error {
-	if !rtr.isInit {
-		if err := rtr.initRoutes(); err != nil {
-			return err
-		}
-	}
-	return http.ListenAndServe(address, rtr)
-}
-
-func GetParamsFromContext(ctx context.Context) httprouter.Params {
-	return httprouter.ParamsFromContext(ctx)
+// handle registers handler in the routing tree of rtr.
+func (rtr *Router) handle(method, path string, handler http.Handler) error {
+	return handle(rtr.router, method, path, rtr.hostname, handler)
 }
 
-func makeCorsHandler(config *corsConfig, debugLogger log.LoggerFunc) func(http.Handler) http.Handler {
-	allowMethods := config.AllowMethods
-	allowHeaders := config.AllowHeaders
-	exposeHeaders := config.ExposeHeaders
-	maxAge := config.MaxAgeStr
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			origin := r.Header.Get(gohttp.HeaderOrigin)
-			allowOrigin := ""
-
-			// Check allowed origins
-			for _, o := range config.AllowOrigins {
-				if o == "*" && config.AllowCredentials {
-					allowOrigin = origin
-					break
-				}
-				if o == "*" || o == origin {
-					allowOrigin = o
-					break
-				}
-				if matchSubdomain(origin, o) {
-					allowOrigin = origin
-					break
-				}
-			}
-
-			_ = debugLogger("event", "cors handler", "msg", fmt.Sprintf("set %s: %s", gohttp.HeaderAccessControlAllowOrigin, allowOrigin))
-
-			if r.Method != http.MethodOptions {
-				w.Header().Add(gohttp.HeaderVary, gohttp.HeaderOrigin)
-				w.Header().Set(gohttp.HeaderAccessControlAllowOrigin, allowOrigin)
-				if config.AllowCredentials {
-					w.Header().Set(gohttp.HeaderAccessControlAllowCredentials, "true")
-				}
-				if exposeHeaders != "" {
-					w.Header().Set(gohttp.HeaderAccessControlExposeHeaders, exposeHeaders)
-				}
-
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			// Handling pre-flight request
-			_ = debugLogger("event", "cors handler", "msg", "handling pre-fligt request")
-			w.Header().Add(gohttp.HeaderVary, gohttp.HeaderOrigin)
-			w.Header().Add(gohttp.HeaderVary, gohttp.HeaderAccessControlRequestMethod)
-			w.Header().Add(gohttp.HeaderVary, gohttp.HeaderAccessControlRequestHeaders)
-			w.Header().Set(gohttp.HeaderAccessControlAllowOrigin, allowOrigin)
-			w.Header().Set(gohttp.HeaderAccessControlAllowMethods, allowMethods)
-
-			if config.AllowCredentials {
-				w.Header().Set(gohttp.HeaderAccessControlAllowCredentials, "true")
-			}
-
-			if allowHeaders != "" {
-				w.Header().Set(gohttp.HeaderAccessControlAllowHeaders, allowHeaders)
-			} else {
-				h := r.Header.Get(gohttp.HeaderAccessControlRequestHeaders)
-				if h != "" {
-					w.Header().Set(gohttp.HeaderAccessControlAllowHeaders, h)
-				}
-			}
-			if config.MaxAge > 0 {
-				w.Header().Set(gohttp.HeaderAccessControlMaxAge, maxAge)
-			}
+// handle registers handler in tree, turning the panic of httprouter on
+// conflicting paths into an error.
+func handle(tree *httprouter.Router, method, path, hostname string, handler http.Handler) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("route conflict for %s %s%s: %v", method, hostname, path, rec)
+		}
+	}()
 
-			_ = debugLogger("event", "cors handler", "msg", "set header for pre-flight request", "header", w.Header())
-			w.WriteHeader(http.StatusOK)
-		})
-	}
+	tree.Handler(method, path, withRoutePattern(path, handler))
+	return nil
 }
 
-// CorsAllowOrigin defines a list of origins that may access the resource.
-// Optional. Default value []string{"*"}.
-func CorsAllowOrigin(origins []string) CorsOption {
-	return func(config *corsConfig) {
-		if len(origins) > 0 {
-			config.AllowOrigins = origins
-		}
+// withRouteMetadata puts the metadata of the route in the context, for the
+// middlewares configurable per route.
+func withRouteMetadata(meta *gohttp.RouteMetadata, handler http.Handler) http.Handler {
+	if meta == nil {
+		return handler
 	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(gohttp.ContextWithRouteMetadata(r.Context(), meta)))
+	})
 }
 
-// CorsAllowMethods defines a list methods allowed when accessing the resource.
-// This is used in response to a preflight request.
-// Optional. Default value DefaultCORSConfig.AllowMethods.
-func CorsAllowMethods(methods []string) CorsOption {
-	return func(config *corsConfig) {
-		if len(methods) > 0 {
-			config.AllowMethods = strings.Join(methods, ",")
+// withRoutePattern puts the pattern of the route in the context, appended to
+// the one of the route mounting the router, if any.
+func withRoutePattern(path string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		pattern := strings.TrimSuffix(RoutePatternFromContext(ctx), "/*"+mountPathParam)
+		if pattern != "" && path == "/" {
+			pattern += path[1:]
+		} else {
+			pattern += path
 		}
-	}
-}
 
-// CorsAllowHeaders defines a list of request headers that can be used when
-// making the actual request. This is in response to a preflight request.
-// Optional. Default value []string{}.
-func CorsAllowHeaders(headers []string) CorsOption {
-	return func(config *corsConfig) {
-		if len(headers) > 0 {
-			config.AllowHeaders = strings.Join(headers, ",")
-		}
-	}
+		gohttp.RecordRoutePattern(ctx, pattern)
+		ctx = gohttp.ContextWithRoutePattern(ctx, pattern)
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(ctx, ContextKeyRoutePattern, pattern)))
+	})
 }
 
-// CorsAllowCredentials indicates whether or not the response to the request
-// can be exposed when the credentials flag is true. When used as part of
-// a response to a preflight request, this indicates whether or not the
-// actual request can be made using credentials.
-// Optional. Default value false.
-func CorsAllowCredentials(allowCredential bool) CorsOption {
-	return func(config *corsConfig) {
-		config.AllowCredentials = allowCredential
+// wrapMiddlewares wraps handler with the middlewares of the router, the
+// first registered middleware being the outermost.
+func (rtr *Router) wrapMiddlewares(handler http.Handler) http.Handler {
+	for i := len(rtr.middlewares) - 1; i >= 0; i-- {
+		handler = rtr.middlewares[i](handler)
 	}
+	return handler
 }
 
-// CorsMaxAge indicates how long (in seconds) the results of a preflight request
-// can be cached.
-// Optional. Default value 0.
-func CorsMaxAge(maxAge int) CorsOption {
-	return func(config *corsConfig) {
-		config.MaxAge = maxAge
-		config.MaxAgeStr = strconv.Itoa(maxAge)
+// GetParamsFromContext returns the path params of the matched route,
+// followed by the params captured from the Host, if any.
+func GetParamsFromContext(ctx context.Context) httprouter.Params {
+	params := httprouter.ParamsFromContext(ctx)
+	if hostParams := HostParamsFromContext(ctx); len(hostParams) > 0 {
+		params = append(append(httprouter.Params{}, params...), hostParams...)
 	}
+	return params
 }
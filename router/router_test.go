@@ -0,0 +1,134 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/likearthian/go-http/middleware"
+	"github.com/tj/assert"
+)
+
+func TestPreRoutingMethodOverride(t *testing.T) {
+	writeMethod := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Method+" "+r.PostForm.Get("name"))
+	})
+
+	var order []string
+	rtr := NewRouter()
+	rtr.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "route")
+			next.ServeHTTP(w, r)
+		})
+	})
+	rtr.UsePreRouting(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "pre")
+			next.ServeHTTP(w, r)
+		})
+	}, middleware.MakeHttpMethodOverrideMiddleware())
+	rtr.Methods(http.MethodPost, http.MethodPut, http.MethodDelete).Handler("/users/:id", writeMethod)
+	rtr.Methods(http.MethodGet).Handler("/users", writeMethod)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		override string
+		form     string
+		code     int
+		body     string
+	}{
+		{"header", http.MethodPost, "/users/1", "put", "", http.StatusOK, "PUT "},
+		{"form", http.MethodPost, "/users/1", "", "_method=DELETE&name=ann", http.StatusOK, "DELETE ann"},
+		{"header wins", http.MethodPost, "/users/1", "PUT", "_method=DELETE", http.StatusOK, "PUT "},
+		{"not allowed", http.MethodPost, "/users/1", "CONNECT", "", http.StatusOK, "POST "},
+		{"only post", http.MethodGet, "/users", "DELETE", "", http.StatusOK, "GET "},
+		{"routed by override", http.MethodPost, "/users", "PATCH", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.form))
+		if test.override != "" {
+			req.Header.Set(gohttp.HeaderXHTTPMethodOverride, test.override)
+		}
+		if test.form != "" {
+			req.Header.Set(gohttp.HeaderContentType, gohttp.HttpContentTypeUrlFormEncoded)
+		}
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, req)
+
+		assert.Equal(t, test.code, rec.Code, test.name)
+		if test.body != "" {
+			assert.Equal(t, test.body, rec.Body.String(), test.name)
+		}
+		// the request of the caller is left untouched
+		assert.Equal(t, test.method, req.Method, test.name)
+	}
+
+	order = nil
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	assert.Equal(t, []string{"pre", "route"}, order)
+
+	// pre-routing middlewares also see unmatched requests
+	order = nil
+	rtr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, []string{"pre"}, order)
+}
+
+func TestAutoHeadAndOptions(t *testing.T) {
+	body := "hello, world"
+	get := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		_, _ = io.WriteString(w, body)
+	})
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var seen []string
+	rtr := NewRouter()
+	rtr.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.Method)
+			next.ServeHTTP(w, r)
+		})
+	})
+	rtr.Methods(http.MethodGet).Handler("/users/:id", get)
+	rtr.Methods(http.MethodDelete).Handler("/users/:id", noop)
+	api := rtr.Subroute("/api")
+	api.Methods(http.MethodGet).Handler("/items", get)
+	api.Methods(http.MethodHead).Handler("/items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", "explicit")
+	}))
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/users/1", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "HEAD", rec.Header().Get("X-Method"))
+	assert.Equal(t, "12", rec.Header().Get(gohttp.HeaderContentLength))
+	assert.Empty(t, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/api/items", nil))
+	assert.Equal(t, "explicit", rec.Header().Get("X-Method"))
+
+	seen = nil
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/users/1", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", rec.Header().Get(gohttp.HeaderAllow))
+	assert.Equal(t, []string{http.MethodOptions}, seen)
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/items", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", rec.Header().Get(gohttp.HeaderAllow))
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,187 @@
+package routertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+// Masked replaces the masked values in snapshots.
+const Masked = "<masked>"
+
+// UpdateGoldenEnv is the environment variable which, when set, makes Golden
+// write the snapshots instead of comparing them.
+const UpdateGoldenEnv = "ROUTERTEST_UPDATE_GOLDEN"
+
+type goldenConfig struct {
+	dir          string
+	update       bool
+	maskHeaders  map[string]bool
+	maskFields   map[string]bool
+	maskPatterns []*regexp.Regexp
+}
+
+func defaultGoldenConfig() goldenConfig {
+	return goldenConfig{
+		dir:    "testdata",
+		update: os.Getenv(UpdateGoldenEnv) != "",
+		maskHeaders: map[string]bool{
+			http.CanonicalHeaderKey(gohttp.HeaderXRequestID): true,
+			"Date": true,
+		},
+		maskFields: map[string]bool{},
+	}
+}
+
+// GoldenDir sets the directory of the snapshot files, testdata by default.
+func GoldenDir(dir string) Option {
+	return func(h *Harness) {
+		h.golden.dir = dir
+	}
+}
+
+// UpdateGolden makes Golden write the snapshots instead of comparing them,
+// as setting ROUTERTEST_UPDATE_GOLDEN does.
+func UpdateGolden(update bool) Option {
+	return func(h *Harness) {
+		h.golden.update = update
+	}
+}
+
+// MaskHeaders masks the values of response headers in snapshots, in
+// addition to X-Request-ID and Date.
+func MaskHeaders(names ...string) Option {
+	return func(h *Harness) {
+		for _, n := range names {
+			h.golden.maskHeaders[http.CanonicalHeaderKey(n)] = true
+		}
+	}
+}
+
+// MaskJSONFields masks the values of the JSON body fields named names, at
+// any depth, in snapshots.
+func MaskJSONFields(names ...string) Option {
+	return func(h *Harness) {
+		for _, n := range names {
+			h.golden.maskFields[n] = true
+		}
+	}
+}
+
+// MaskPattern masks the matches of re in snapshots, e.g. generated ids in a
+// text body.
+func MaskPattern(re *regexp.Regexp) Option {
+	return func(h *Harness) {
+		h.golden.maskPatterns = append(h.golden.maskPatterns, re)
+	}
+}
+
+// Snapshot renders the response as text: the status line, the sorted
+// headers and the body, indented when it is JSON, with the volatile values
+// masked.
+func (r *Response) Snapshot() string {
+	cfg := r.h.golden
+	var b strings.Builder
+
+	b.WriteString("HTTP " + strconv.Itoa(r.Recorder.Code) + " " + http.StatusText(r.Recorder.Code) + "\n")
+
+	header := r.Recorder.Header()
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			if cfg.maskHeaders[http.CanonicalHeaderKey(k)] {
+				v = Masked
+			}
+			b.WriteString(k + ": " + v + "\n")
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(r.snapshotBody())
+
+	snapshot := b.String()
+	for _, re := range cfg.maskPatterns {
+		snapshot = re.ReplaceAllString(snapshot, Masked)
+	}
+	return snapshot
+}
+
+func (r *Response) snapshotBody() string {
+	body := r.Recorder.Body.Bytes()
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if len(bytes.TrimSpace(body)) == 0 || dec.Decode(&v) != nil || dec.More() {
+		return string(body)
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(maskFields(v, r.h.golden.maskFields)); err != nil {
+		return string(body)
+	}
+	return out.String()
+}
+
+func maskFields(v interface{}, fields map[string]bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if fields[k] {
+				t[k] = Masked
+				continue
+			}
+			t[k] = maskFields(val, fields)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = maskFields(val, fields)
+		}
+	}
+	return v
+}
+
+// Golden compares the snapshot of the response with the file name.golden of
+// the golden directory. When updating, the file is written instead.
+func (r *Response) Golden(name string) *Response {
+	r.h.t.Helper()
+
+	path := filepath.Join(r.h.golden.dir, name+".golden")
+	snapshot := r.Snapshot()
+
+	if r.h.golden.update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			r.h.t.Fatalf("failed to create golden directory: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(snapshot), 0644); err != nil {
+			r.h.t.Fatalf("failed to write golden file: %v", err)
+		}
+		return r
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		r.h.t.Errorf("%s: failed to read golden file, set %s=1 to create it: %v", r.name, UpdateGoldenEnv, err)
+		return r
+	}
+
+	if string(want) != snapshot {
+		r.h.t.Errorf("%s: response does not match %s\n--- want\n%s\n--- got\n%s", r.name, path, want, snapshot)
+	}
+	return r
+}
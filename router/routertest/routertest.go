@@ -0,0 +1,325 @@
+// Package routertest serves requests to a router, or any http.Handler such
+// as a go-kit server, in process and asserts on the responses.
+//
+//	h := routertest.New(t, rtr)
+//	h.Get("/users/42").Header("X-Tenant", "acme").Do().
+//		Status(http.StatusOK).
+//		JSONPath("name", "ann").
+//		Golden("get_user")
+package routertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+// Harness serves requests to a handler and reports failed assertions to t.
+type Harness struct {
+	t       testing.TB
+	handler http.Handler
+	golden  goldenConfig
+}
+
+type Option func(*Harness)
+
+// New creates a harness serving requests to handler, typically a
+// *router.Router.
+func New(t testing.TB, handler http.Handler, options ...Option) *Harness {
+	h := &Harness{
+		t:       t,
+		handler: handler,
+		golden:  defaultGoldenConfig(),
+	}
+	for _, op := range options {
+		op(h)
+	}
+	return h
+}
+
+// Request is a request being built. Errors met while building it fail the
+// test when the request is sent.
+type Request struct {
+	h      *Harness
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+	err    error
+}
+
+func (h *Harness) Request(method, path string) *Request {
+	return &Request{
+		h:      h,
+		method: method,
+		path:   path,
+		query:  url.Values{},
+		header: http.Header{},
+	}
+}
+
+func (h *Harness) Get(path string) *Request    { return h.Request(http.MethodGet, path) }
+func (h *Harness) Head(path string) *Request   { return h.Request(http.MethodHead, path) }
+func (h *Harness) Post(path string) *Request   { return h.Request(http.MethodPost, path) }
+func (h *Harness) Put(path string) *Request    { return h.Request(http.MethodPut, path) }
+func (h *Harness) Patch(path string) *Request  { return h.Request(http.MethodPatch, path) }
+func (h *Harness) Delete(path string) *Request { return h.Request(http.MethodDelete, path) }
+
+// Query adds the fields of v, a struct or map, to the query string, encoded
+// by their query tag as gohttp.EncodeToURLQuery does.
+func (r *Request) Query(v interface{}) *Request {
+	q, err := gohttp.EncodeToURLQuery(v, "query")
+	if err != nil {
+		r.err = fmt.Errorf("failed to encode query: %w", err)
+		return r
+	}
+	for k, values := range q {
+		r.query[k] = append(r.query[k], values...)
+	}
+	return r
+}
+
+// QueryParam adds a value to the query string.
+func (r *Request) QueryParam(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Header sets a request header.
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// JSON sets the body to v encoded as JSON.
+func (r *Request) JSON(v interface{}) *Request {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.err = fmt.Errorf("failed to encode body: %w", err)
+		return r
+	}
+	r.body = data
+	r.header.Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+	return r
+}
+
+// Body sets the raw body and its content type.
+func (r *Request) Body(contentType string, body []byte) *Request {
+	r.body = body
+	r.header.Set(gohttp.HeaderContentType, contentType)
+	return r
+}
+
+// Build returns the *http.Request described by r.
+func (r *Request) Build() (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	target := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+
+	req := httptest.NewRequest(r.method, target, body)
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+// Do serves the request and returns the response.
+func (r *Request) Do() *Response {
+	r.h.t.Helper()
+
+	resp := &Response{h: r.h, Recorder: httptest.NewRecorder()}
+	req, err := r.Build()
+	if err != nil {
+		r.h.t.Fatalf("%s %s: %v", r.method, r.path, err)
+		return resp
+	}
+
+	resp.name = r.method + " " + req.URL.RequestURI()
+	r.h.handler.ServeHTTP(resp.Recorder, req)
+	return resp
+}
+
+// Response is a recorded response. Its assertion methods report failures
+// to the test and return the response, so they can be chained.
+type Response struct {
+	h        *Harness
+	name     string
+	Recorder *httptest.ResponseRecorder
+
+	decoded    interface{}
+	decodedErr error
+	isDecoded  bool
+}
+
+// Status asserts the status code.
+func (r *Response) Status(code int) *Response {
+	r.h.t.Helper()
+	if r.Recorder.Code != code {
+		r.h.t.Errorf("%s: status = %d, want %d; body: %s", r.name, r.Recorder.Code, code, r.Recorder.Body.String())
+	}
+	return r
+}
+
+// Header asserts the value of a response header.
+func (r *Response) Header(key, value string) *Response {
+	r.h.t.Helper()
+	if got := r.Recorder.Header().Get(key); got != value {
+		r.h.t.Errorf("%s: header %s = %q, want %q", r.name, key, got, value)
+	}
+	return r
+}
+
+// HeaderPresent asserts that a response header is set.
+func (r *Response) HeaderPresent(key string) *Response {
+	r.h.t.Helper()
+	if _, ok := r.Recorder.Header()[http.CanonicalHeaderKey(key)]; !ok {
+		r.h.t.Errorf("%s: header %s is missing", r.name, key)
+	}
+	return r
+}
+
+// BodyString asserts the raw body.
+func (r *Response) BodyString(body string) *Response {
+	r.h.t.Helper()
+	if got := r.Recorder.Body.String(); got != body {
+		r.h.t.Errorf("%s: body = %q, want %q", r.name, got, body)
+	}
+	return r
+}
+
+// JSONPath asserts the value found at path in the JSON body. The path is
+// made of object keys and array indexes, as in data.items[0].name; want is
+// compared to the value once encoded to JSON, so numbers of any Go type
+// match.
+func (r *Response) JSONPath(path string, want interface{}) *Response {
+	r.h.t.Helper()
+
+	body, err := r.json()
+	if err != nil {
+		r.h.t.Errorf("%s: %v", r.name, err)
+		return r
+	}
+
+	got, err := lookupJSONPath(body, path)
+	if err != nil {
+		r.h.t.Errorf("%s: %v", r.name, err)
+		return r
+	}
+
+	wantData, err := json.Marshal(want)
+	if err != nil {
+		r.h.t.Errorf("%s: failed to encode expected value: %v", r.name, err)
+		return r
+	}
+	var wantValue interface{}
+	_ = json.Unmarshal(wantData, &wantValue)
+
+	if !reflect.DeepEqual(got, wantValue) {
+		gotData, _ := json.Marshal(got)
+		r.h.t.Errorf("%s: %s = %s, want %s", r.name, path, gotData, wantData)
+	}
+	return r
+}
+
+// Decode decodes the JSON body into v.
+func (r *Response) Decode(v interface{}) *Response {
+	r.h.t.Helper()
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), v); err != nil {
+		r.h.t.Errorf("%s: failed to decode body: %v", r.name, err)
+	}
+	return r
+}
+
+func (r *Response) json() (interface{}, error) {
+	if !r.isDecoded {
+		r.isDecoded = true
+		if err := json.Unmarshal(r.Recorder.Body.Bytes(), &r.decoded); err != nil {
+			r.decodedErr = fmt.Errorf("body is not JSON: %w", err)
+		}
+	}
+	return r.decoded, r.decodedErr
+}
+
+// lookupJSONPath returns the value of a decoded JSON document at path, e.g.
+// data.items[0].name. A leading "$." is ignored.
+func lookupJSONPath(v interface{}, path string) (interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	cur := v
+	walked := "$"
+
+	for path != "" {
+		var key string
+		index := -1
+
+		switch {
+		case path[0] == '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path: unclosed [ after %s", walked)
+			}
+			i, err := strconv.Atoi(path[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path: bad index %q after %s", path[1:end], walked)
+			}
+			index = i
+			path = path[end+1:]
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			key = path[:end]
+			path = path[end:]
+		}
+		path = strings.TrimPrefix(path, ".")
+
+		if index >= 0 {
+			arr, ok := cur.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not an array", walked)
+			}
+			if index >= len(arr) {
+				return nil, fmt.Errorf("%s has %d items, no index %d", walked, len(arr), index)
+			}
+			cur = arr[index]
+			walked += "[" + strconv.Itoa(index) + "]"
+			continue
+		}
+
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s is not an object", walked)
+		}
+		if cur, ok = obj[key]; !ok {
+			return nil, fmt.Errorf("%s has no key %q", walked, key)
+		}
+		walked += "." + key
+	}
+
+	return cur, nil
+}
@@ -0,0 +1,107 @@
+package routertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/likearthian/go-http/router"
+	"github.com/tj/assert"
+)
+
+type searchQuery struct {
+	Name  string   `query:"name"`
+	Tags  []string `query:"tag"`
+	Limit int      `query:"limit"`
+}
+
+type user struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Tags      []string `json:"tags"`
+	RequestID string   `json:"request_id"`
+}
+
+func newTestRouter() *router.Router {
+	rtr := router.NewRouter()
+	rtr.Methods(http.MethodGet).Handler("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var q searchQuery
+		_ = gohttp.BindURLQuery(&q, r.URL.Query())
+		w.Header().Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+		w.Header().Set(gohttp.HeaderXRequestID, "req-123")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"users": []user{{ID: 1, Name: q.Name, Tags: q.Tags, RequestID: "req-123"}},
+			"limit": q.Limit,
+		})
+	}))
+	rtr.Methods(http.MethodPost).Handler("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var u user
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, "created %s as 9f8e7d\n", u.Name)
+	}))
+	return rtr
+}
+
+func TestHarness(t *testing.T) {
+	h := New(t, newTestRouter(), MaskJSONFields("request_id"), MaskPattern(regexp.MustCompile(`\b[0-9a-f]{6}\b`)))
+
+	var decoded struct {
+		Users []user `json:"users"`
+	}
+	h.Get("/users").
+		Query(searchQuery{Name: "ann", Tags: []string{"a", "b"}, Limit: 10}).
+		Header(gohttp.HeaderAccept, gohttp.HttpContentTypeJson).
+		Do().
+		Status(http.StatusOK).
+		Header(gohttp.HeaderContentType, gohttp.HttpContentTypeJson).
+		HeaderPresent(gohttp.HeaderXRequestID).
+		JSONPath("users[0].name", "ann").
+		JSONPath("$.users[0].tags", []string{"a", "b"}).
+		JSONPath("limit", 10).
+		Decode(&decoded).
+		Golden("list_users")
+	assert.Equal(t, 1, decoded.Users[0].ID)
+
+	h.Post("/users").JSON(user{Name: "bob"}).Do().
+		Status(http.StatusCreated).
+		Golden("create_user")
+}
+
+// recorder is a testing.TB recording the failures instead of reporting them.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestHarnessFailures(t *testing.T) {
+	rec := &recorder{TB: t}
+	h := New(rec, newTestRouter())
+
+	h.Get("/users").QueryParam("name", "ann").Do().
+		Status(http.StatusNotFound).
+		Header("X-Missing", "x").
+		JSONPath("users[1].name", "ann").
+		JSONPath("users[0].name", "bob").
+		JSONPath("users[0].name.first", "ann")
+
+	assert.Equal(t, []string{
+		`GET /users?name=ann: status = 200, want 404; body: {"limit":0,"users":[{"id":1,"name":"ann","tags":null,"request_id":"req-123"}]}` + "\n",
+		`GET /users?name=ann: header X-Missing = "", want "x"`,
+		`GET /users?name=ann: $.users has 1 items, no index 1`,
+		`GET /users?name=ann: users[0].name = "ann", want "bob"`,
+		`GET /users?name=ann: $.users[0].name is not an object`,
+	}, rec.errors)
+}
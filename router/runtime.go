@@ -0,0 +1,288 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ErrRuntimeRoutesDisabled is returned when routes are changed at runtime on
+// a router created without the RuntimeRoutes option.
+var ErrRuntimeRoutesDisabled = errors.New("runtime routes are not enabled on this router")
+
+// ErrRuntimeRoutesSubrouter is returned by AddRoute, ReplaceRoute,
+// RemoveRoute and Build for a sub router created with the RuntimeRoutes
+// option: only the runtime routes of the router serving the requests are
+// matched.
+var ErrRuntimeRoutesSubrouter = errors.New("runtime routes are not supported on sub routers")
+
+// runtimeTable holds the routes changed while serving. Changes are
+// serialized by mu and build a new tree, which is swapped into tree once
+// complete: requests never wait for a change, and the ones in flight finish
+// on the tree they started with.
+type runtimeTable struct {
+	mu     sync.Mutex
+	routes []runtimeRoute
+	tree   atomic.Value // *httprouter.Router
+	// err is set when the table belongs to a router that cannot serve it
+	err error
+}
+
+type runtimeRoute struct {
+	method  string
+	path    string
+	handler http.Handler
+}
+
+// RuntimeRoutes enables AddRoute, ReplaceRoute and RemoveRoute on the router.
+// Routes registered at runtime are matched before the ones registered with
+// Methods; a request matching none of them falls through to the latter. GET
+// routes get a HEAD route and the Allow header of OPTIONS and 405 responses
+// lists the methods of both, as for the routes registered with Methods. It
+// is not supported by Subroute, the routers of Host and Version serve their
+// own runtime routes.
+func RuntimeRoutes() RouterOption {
+	return func(r *Router) {
+		r.runtime = &runtimeTable{}
+	}
+}
+
+// AddRoute registers handler for path and methods while the router is
+// serving. It fails when one of the methods is already registered at runtime
+// for path, or when path conflicts with another runtime route.
+func (rtr *Router) AddRoute(path string, handler http.Handler, methods ...string) error {
+	return rtr.changeRoutes("route added", path, methods, func(routes []runtimeRoute) ([]runtimeRoute, error) {
+		if handler == nil {
+			return nil, fmt.Errorf("no handler for path %s", path)
+		}
+		if len(methods) == 0 {
+			return nil, fmt.Errorf("no methods for path %s", path)
+		}
+		for _, m := range methods {
+			if i := findRuntimeRoute(routes, m, path); i >= 0 {
+				return nil, fmt.Errorf("route %s %s already exists", m, path)
+			}
+			routes = append(routes, runtimeRoute{method: m, path: path, handler: handler})
+		}
+		return routes, nil
+	})
+}
+
+// ReplaceRoute swaps the handler of runtime routes registered for path and
+// methods. It fails when one of them does not exist.
+func (rtr *Router) ReplaceRoute(path string, handler http.Handler, methods ...string) error {
+	return rtr.changeRoutes("route replaced", path, methods, func(routes []runtimeRoute) ([]runtimeRoute, error) {
+		if handler == nil {
+			return nil, fmt.Errorf("no handler for path %s", path)
+		}
+		if len(methods) == 0 {
+			return nil, fmt.Errorf("no methods for path %s", path)
+		}
+		for _, m := range methods {
+			i := findRuntimeRoute(routes, m, path)
+			if i < 0 {
+				return nil, fmt.Errorf("route %s %s does not exist", m, path)
+			}
+			routes[i].handler = handler
+		}
+		return routes, nil
+	})
+}
+
+// RemoveRoute unregisters the runtime routes of path for methods, or for
+// every method when none is given. It fails when no route is removed.
+func (rtr *Router) RemoveRoute(path string, methods ...string) error {
+	methods = uniqueMethods(methods)
+	return rtr.changeRoutes("route removed", path, methods, func(routes []runtimeRoute) ([]runtimeRoute, error) {
+		kept := routes[:0]
+		removed := 0
+		for _, r := range routes {
+			if r.path == path && (len(methods) == 0 || containsMethod(methods, r.method)) {
+				removed++
+				continue
+			}
+			kept = append(kept, r)
+		}
+		if removed == 0 || len(methods) > 0 && removed != len(methods) {
+			return nil, fmt.Errorf("route %s does not exist", strings.TrimSpace(strings.Join(methods, ",")+" "+path))
+		}
+		return kept, nil
+	})
+}
+
+// changeRoutes applies change to a copy of the runtime routes, builds their
+// tree and swaps it in. The routes are left untouched when change or the
+// build fails.
+func (rtr *Router) changeRoutes(event, path string, methods []string, change func([]runtimeRoute) ([]runtimeRoute, error)) error {
+	t := rtr.runtime
+	if t == nil {
+		return ErrRuntimeRoutesDisabled
+	}
+	if t.err != nil {
+		return t.err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	routes, err := change(append([]runtimeRoute(nil), t.routes...))
+	if err == nil {
+		err = rtr.swapRuntimeTree(routes)
+	}
+	if err != nil {
+		_ = rtr.debugLogger("event", event, "methods", methods, "path", path, "err", err)
+		return err
+	}
+
+	t.routes = routes
+	_ = rtr.debugLogger("event", event, "methods", methods, "path", path, "routes", len(routes))
+	return nil
+}
+
+func (rtr *Router) swapRuntimeTree(routes []runtimeRoute) error {
+	tree := httprouter.New()
+	// requests the runtime routes do not serve are passed on untouched to the
+	// routes registered with Methods
+	tree.RedirectTrailingSlash = false
+	tree.RedirectFixedPath = false
+	tree.HandleMethodNotAllowed = false
+	tree.HandleOPTIONS = false
+
+	methods := []string{}
+	heads := map[string]bool{}
+	for _, r := range routes {
+		if r.method == http.MethodHead {
+			heads[r.path] = true
+		}
+	}
+	for _, r := range routes {
+		if err := handle(tree, r.method, rtr.prefix+r.path, rtr.hostname, rtr.wrapMiddlewares(r.handler)); err != nil {
+			return err
+		}
+		methods = appendMethod(methods, r.method)
+
+		if r.method == http.MethodGet && !heads[r.path] {
+			heads[r.path] = true
+			if err := handle(tree, http.MethodHead, rtr.prefix+r.path, rtr.hostname, rtr.wrapMiddlewares(headHandler(r.handler))); err != nil {
+				return err
+			}
+			methods = appendMethod(methods, http.MethodHead)
+		}
+	}
+	tree.NotFound = rtr.runtimeMiss(tree, methods)
+
+	rtr.runtime.tree.Store(tree)
+	return nil
+}
+
+// runtimeMiss serves the requests the runtime routes of tree do not serve
+// for their method. They go to the routes registered with Methods, unless
+// the path is served by other methods only: the request is then answered
+// like httprouter does, with the Allow header listing the methods of both.
+func (rtr *Router) runtimeMiss(tree *httprouter.Router, methods []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+
+		var allowed []string
+		for _, m := range methods {
+			if h, _, _ := tree.Lookup(m, path); h != nil {
+				allowed = append(allowed, m)
+			}
+		}
+		if h, _, _ := rtr.router.Lookup(r.Method, path); h != nil || len(allowed) == 0 {
+			rtr.router.ServeHTTP(w, r)
+			return
+		}
+
+		var static []string
+		rtr.eachTreeRoute(func(route *Route) {
+			for _, m := range route.methods {
+				static = appendMethod(static, m)
+			}
+		})
+		for _, m := range appendMethod(static, http.MethodHead) {
+			if h, _, _ := rtr.router.Lookup(m, path); h != nil {
+				allowed = appendMethod(allowed, m)
+			}
+		}
+		allowed = appendMethod(allowed, http.MethodOptions)
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+		if r.Method == http.MethodOptions {
+			if rtr.router.GlobalOPTIONS != nil {
+				rtr.router.GlobalOPTIONS.ServeHTTP(w, r)
+			}
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	})
+}
+
+// runtimeTree returns the tree of the runtime routes, nil when there is none.
+func (rtr *Router) runtimeTree() *httprouter.Router {
+	if rtr.runtime == nil {
+		return nil
+	}
+	tree, _ := rtr.runtime.tree.Load().(*httprouter.Router)
+	return tree
+}
+
+// runtimeRouteInfos lists the runtime routes, one per method.
+func (rtr *Router) runtimeRouteInfos(routes []RouteInfo, mountPrefix, host, version string) []RouteInfo {
+	if rtr.runtime == nil {
+		return routes
+	}
+
+	rtr.runtime.mu.Lock()
+	defer rtr.runtime.mu.Unlock()
+
+	for _, r := range rtr.runtime.routes {
+		routes = append(routes, RouteInfo{
+			Methods: []string{r.method},
+			Host:    host,
+			Path:    mountPrefix + rtr.prefix + r.path,
+			Version: version,
+		})
+	}
+	return routes
+}
+
+func findRuntimeRoute(routes []runtimeRoute, method, path string) int {
+	for i, r := range routes {
+		if r.method == method && r.path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+func appendMethod(methods []string, method string) []string {
+	if containsMethod(methods, method) {
+		return methods
+	}
+	return append(methods, method)
+}
+
+func uniqueMethods(methods []string) []string {
+	var unique []string
+	for _, m := range methods {
+		unique = appendMethod(unique, m)
+	}
+	return unique
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func TestRuntimeRoutes(t *testing.T) {
+	write := func(s string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, s+GetParamsFromContext(r.Context()).ByName("id"))
+		})
+	}
+
+	var events []string
+	rtr := NewRouter(RuntimeRoutes(), SetDebugLogger(func(keyvals ...interface{}) error {
+		events = append(events, fmt.Sprint(keyvals[1]))
+		return nil
+	}))
+	rtr.Methods(http.MethodGet).Handler("/static", write("static"))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/plugins/1").Code)
+
+	assert.NoError(t, rtr.AddRoute("/plugins/:id", write("v1 "), http.MethodGet, http.MethodPost))
+	assert.Equal(t, "v1 1", serve(http.MethodGet, "/plugins/1").Body.String())
+	assert.Equal(t, "v1 2", serve(http.MethodPost, "/plugins/2").Body.String())
+	assert.Equal(t, "static", serve(http.MethodGet, "/static").Body.String())
+
+	assert.EqualError(t, rtr.AddRoute("/plugins/:id", write("dup"), http.MethodGet), "route GET /plugins/:id already exists")
+	assert.Error(t, rtr.AddRoute("/plugins/:name", write("conflict"), http.MethodPut, http.MethodGet))
+	// a failed change leaves the table untouched
+	rec := serve(http.MethodPut, "/plugins/1")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", rec.Header().Get("Allow"))
+
+	assert.NoError(t, rtr.ReplaceRoute("/plugins/:id", write("v2 "), http.MethodGet))
+	assert.Equal(t, "v2 1", serve(http.MethodGet, "/plugins/1").Body.String())
+	assert.Equal(t, "v1 1", serve(http.MethodPost, "/plugins/1").Body.String())
+	assert.EqualError(t, rtr.ReplaceRoute("/missing", write(""), http.MethodGet), "route GET /missing does not exist")
+
+	assert.NoError(t, rtr.RemoveRoute("/plugins/:id", http.MethodPost, http.MethodPost))
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/plugins/1").Code)
+	assert.Len(t, rtr.Routes(), 2)
+
+	assert.NoError(t, rtr.RemoveRoute("/plugins/:id"))
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/plugins/1").Code)
+	assert.EqualError(t, rtr.RemoveRoute("/plugins/:id"), "route /plugins/:id does not exist")
+
+	assert.Equal(t, []string{
+		"route registered",
+		"route added", "route added", "route added", "route replaced", "route replaced",
+		"route removed", "route removed", "route removed",
+	}, events)
+
+	assert.Equal(t, ErrRuntimeRoutesDisabled, NewRouter().AddRoute("/x", write(""), http.MethodGet))
+}
+
+func TestRuntimeRoutesHeadAndOptions(t *testing.T) {
+	rtr := NewRouter(RuntimeRoutes())
+	rtr.Methods(http.MethodPost).Handler("/items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	assert.NoError(t, rtr.AddRoute("/items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "items")
+	}), http.MethodGet))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodHead, "/items")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("Content-Length"))
+	assert.Equal(t, 0, rec.Body.Len())
+
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/items").Code)
+
+	rec = serve(http.MethodOptions, "/items")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", rec.Header().Get("Allow"))
+
+	rec = serve(http.MethodDelete, "/items")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", rec.Header().Get("Allow"))
+
+	assert.NoError(t, rtr.RemoveRoute("/items", http.MethodGet))
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodHead, "/items").Code)
+	assert.Equal(t, "OPTIONS, POST", serve(http.MethodOptions, "/items").Header().Get("Allow"))
+}
+
+func TestRuntimeRoutesConcurrentSwap(t *testing.T) {
+	rtr := NewRouter(RuntimeRoutes())
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	assert.NoError(t, rtr.AddRoute("/stable", ok, http.MethodGet))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				rec := httptest.NewRecorder()
+				rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stable", nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("unexpected status %d", rec.Code)
+					return
+				}
+			}
+		}()
+	}
+
+	for j := 0; j < 50; j++ {
+		path := fmt.Sprintf("/dyn/%d", j)
+		assert.NoError(t, rtr.AddRoute(path, ok, http.MethodGet))
+		if j%2 == 0 {
+			assert.NoError(t, rtr.RemoveRoute(path))
+		}
+	}
+	wg.Wait()
+}
+
+func TestRuntimeRoutesSubrouter(t *testing.T) {
+	rtr := NewRouter()
+	admin := rtr.Subroute("/admin", RuntimeRoutes())
+
+	err := admin.AddRoute("/plugin", http.NotFoundHandler(), http.MethodGet)
+	assert.True(t, errors.Is(err, ErrRuntimeRoutesSubrouter))
+	assert.EqualError(t, rtr.Build(), "runtime routes are not supported on sub routers: /admin")
+}
@@ -0,0 +1,274 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultReadTimeout       = 30 * time.Second
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20
+	defaultShutdownTimeout   = 15 * time.Second
+)
+
+// ShutdownHook is called once the server has stopped accepting connections
+// and in-flight requests were drained. It is typically used to close database
+// pools and other resources held by the handlers.
+type ShutdownHook func(ctx context.Context) error
+
+type ServerOption func(*serverConfig)
+
+type serverConfig struct {
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	shutdownTimeout   time.Duration
+	tlsConfig         *tls.Config
+	certFile          string
+	keyFile           string
+	signals           []os.Signal
+	shutdownHooks     []ShutdownHook
+
+	// tls is set by the RunTLS entry points
+	tls bool
+	// listening is called with the address of the listener, for the tests
+	listening func(addr net.Addr)
+}
+
+func defaultServerConfig() serverConfig {
+	return serverConfig{
+		readTimeout:       defaultReadTimeout,
+		readHeaderTimeout: defaultReadHeaderTimeout,
+		writeTimeout:      defaultWriteTimeout,
+		idleTimeout:       defaultIdleTimeout,
+		maxHeaderBytes:    defaultMaxHeaderBytes,
+		shutdownTimeout:   defaultShutdownTimeout,
+		signals:           []os.Signal{os.Interrupt, syscall.SIGTERM},
+	}
+}
+
+// ServerReadTimeout sets the maximum duration for reading the entire request,
+// including the body. Zero means no timeout.
+// Optional. Default value 30s.
+func ServerReadTimeout(timeout time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.readTimeout = timeout
+	}
+}
+
+// ServerReadHeaderTimeout sets the amount of time allowed to read request
+// headers. Zero means the read timeout applies.
+// Optional. Default value 10s.
+func ServerReadHeaderTimeout(timeout time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.readHeaderTimeout = timeout
+	}
+}
+
+// ServerWriteTimeout sets the maximum duration before timing out writes of
+// the response. Zero means no timeout, which is needed for long streaming
+// responses.
+// Optional. Default value 30s.
+func ServerWriteTimeout(timeout time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.writeTimeout = timeout
+	}
+}
+
+// ServerIdleTimeout sets the maximum amount of time to wait for the next
+// request when keep-alives are enabled. Zero means the read timeout applies.
+// Optional. Default value 120s.
+func ServerIdleTimeout(timeout time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.idleTimeout = timeout
+	}
+}
+
+// ServerMaxHeaderBytes controls the maximum number of bytes the server will
+// read parsing the request header's keys and values. The header size cannot
+// be unlimited: zero means the net/http default, 1MB.
+// Optional. Default value 1MB.
+func ServerMaxHeaderBytes(size int) ServerOption {
+	return func(c *serverConfig) {
+		c.maxHeaderBytes = size
+	}
+}
+
+// ServerShutdownTimeout sets how long in-flight requests are given to finish
+// once shutdown starts. Shutdown hooks share the same deadline. Zero means no
+// timeout.
+// Optional. Default value 15s.
+func ServerShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.shutdownTimeout = timeout
+	}
+}
+
+// ServerTLSConfig sets the tls.Config used by RunTLS and RunTLSContext. When
+// the config already carries certificates, the cert and key files may be
+// left empty. Run and RunContext ignore it and serve plain HTTP.
+func ServerTLSConfig(config *tls.Config) ServerOption {
+	return func(c *serverConfig) {
+		c.tlsConfig = config
+	}
+}
+
+// ServerShutdownSignals overrides the os signals that trigger a graceful
+// shutdown.
+// Optional. Default value os.Interrupt and syscall.SIGTERM.
+func ServerShutdownSignals(signals ...os.Signal) ServerOption {
+	return func(c *serverConfig) {
+		c.signals = signals
+	}
+}
+
+// ServerOnShutdown registers hooks that are called, in registration order,
+// after the server has been drained.
+func ServerOnShutdown(hooks ...ShutdownHook) ServerOption {
+	return func(c *serverConfig) {
+		c.shutdownHooks = append(c.shutdownHooks, hooks...)
+	}
+}
+
+// Run starts the http server on address and blocks until it is stopped by
+// SIGINT or SIGTERM.
+func (rtr *Router) Run(address string, options ...ServerOption) error {
+	return rtr.RunContext(context.Background(), address, options...)
+}
+
+// RunContext starts the http server on address and blocks until ctx is done
+// or a shutdown signal is received. In-flight requests are then drained
+// within the shutdown timeout and the shutdown hooks are called.
+func (rtr *Router) RunContext(ctx context.Context, address string, options ...ServerOption) error {
+	config := defaultServerConfig()
+	for _, op := range options {
+		op(&config)
+	}
+
+	return rtr.serve(ctx, address, config)
+}
+
+// RunTLS is like Run but serves HTTPS using certFile and keyFile.
+func (rtr *Router) RunTLS(address, certFile, keyFile string, options ...ServerOption) error {
+	return rtr.RunTLSContext(context.Background(), address, certFile, keyFile, options...)
+}
+
+// RunTLSContext is like RunContext but serves HTTPS using certFile and
+// keyFile, or the certificates of the config set with ServerTLSConfig.
+func (rtr *Router) RunTLSContext(ctx context.Context, address, certFile, keyFile string, options ...ServerOption) error {
+	config := defaultServerConfig()
+	for _, op := range options {
+		op(&config)
+	}
+
+	config.tls = true
+	config.certFile = certFile
+	config.keyFile = keyFile
+	if config.tlsConfig == nil {
+		config.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if certFile == "" && keyFile == "" && len(config.tlsConfig.Certificates) == 0 && config.tlsConfig.GetCertificate == nil {
+		return errors.New("no certificate given for TLS server")
+	}
+
+	return rtr.serve(ctx, address, config)
+}
+
+func (rtr *Router) serve(ctx context.Context, address string, config serverConfig) error {
+	if err := rtr.Build(); err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           rtr,
+		ReadTimeout:       config.readTimeout,
+		ReadHeaderTimeout: config.readHeaderTimeout,
+		WriteTimeout:      config.writeTimeout,
+		IdleTimeout:       config.idleTimeout,
+		MaxHeaderBytes:    config.maxHeaderBytes,
+	}
+	if config.tls {
+		srv.TLSConfig = config.tlsConfig
+	}
+
+	if address == "" {
+		address = ":http"
+		if config.tls {
+			address = ":https"
+		}
+	}
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	if config.listening != nil {
+		config.listening(ln.Addr())
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if config.tls {
+			serverErr <- srv.ServeTLS(ln, config.certFile, config.keyFile)
+			return
+		}
+		serverErr <- srv.Serve(ln)
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	if len(config.signals) > 0 {
+		signal.Notify(sigs, config.signals...)
+		defer signal.Stop(sigs)
+	}
+
+	select {
+	case err := <-serverErr:
+		// the server failed before any shutdown was requested
+		return err
+	case sig := <-sigs:
+		_ = rtr.debugLogger("event", "server shutdown", "msg", fmt.Sprintf("received signal %s", sig))
+	case <-ctx.Done():
+		_ = rtr.debugLogger("event", "server shutdown", "msg", "context done", "err", ctx.Err())
+	}
+
+	shutdownCtx, cancel := context.WithCancel(context.Background())
+	if config.shutdownTimeout > 0 {
+		shutdownCtx, cancel = context.WithTimeout(context.Background(), config.shutdownTimeout)
+	}
+	defer cancel()
+
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		err = fmt.Errorf("failed to drain in-flight requests: %w", err)
+	}
+
+	for _, hook := range config.shutdownHooks {
+		if hookErr := hook(shutdownCtx); hookErr != nil {
+			_ = rtr.debugLogger("event", "server shutdown", "msg", "shutdown hook failed", "err", hookErr)
+			if err == nil {
+				err = fmt.Errorf("shutdown hook failed: %w", hookErr)
+			}
+		}
+	}
+
+	if srvErr := <-serverErr; srvErr != nil && srvErr != http.ErrServerClosed && err == nil {
+		err = srvErr
+	}
+
+	_ = rtr.debugLogger("event", "server shutdown", "msg", "server stopped")
+	return err
+}
@@ -0,0 +1,155 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+// startServer serves rtr with config and waits until it is listening.
+func startServer(t *testing.T, ctx context.Context, rtr *Router, config serverConfig) (string, chan error) {
+	addr := make(chan string, 1)
+	config.listening = func(a net.Addr) { addr <- a.String() }
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rtr.serve(ctx, "127.0.0.1:0", config)
+	}()
+
+	select {
+	case a := <-addr:
+		return a, done
+	case err := <-done:
+		t.Fatalf("server failed to start: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not start")
+	}
+	return "", nil
+}
+
+func TestRunContextShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	rtr := NewRouter()
+	rtr.Methods(http.MethodGet).Handler("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	}))
+
+	var hooks []string
+	config := defaultServerConfig()
+	config.signals = nil
+	ServerShutdownTimeout(2 * time.Second)(&config)
+	ServerOnShutdown(
+		func(ctx context.Context) error { hooks = append(hooks, "db"); return nil },
+		func(ctx context.Context) error { hooks = append(hooks, "cache"); return nil },
+	)(&config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, done := startServer(t, ctx, rtr, config)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	resp := make(chan result, 1)
+	go func() {
+		res, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			resp <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		resp <- result{status: res.StatusCode, body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	// the server waits for the request in flight
+	select {
+	case err := <-done:
+		t.Fatalf("server stopped before the request was drained: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Empty(t, hooks)
+
+	close(release)
+
+	r := <-resp
+	assert.NoError(t, r.err)
+	assert.Equal(t, http.StatusOK, r.status)
+	assert.Equal(t, "done", r.body)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not stop after context cancellation")
+	}
+
+	assert.Equal(t, []string{"db", "cache"}, hooks)
+}
+
+func TestRunContextIgnoresTLSConfig(t *testing.T) {
+	rtr := NewRouter()
+	rtr.Methods(http.MethodGet).Handler("/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "pong")
+	}))
+
+	config := defaultServerConfig()
+	config.signals = nil
+	ServerTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12})(&config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, done := startServer(t, ctx, rtr, config)
+
+	res, err := http.Get("http://" + addr + "/ping")
+	assert.NoError(t, err)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "pong", string(body))
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestServerOptionsZero(t *testing.T) {
+	config := defaultServerConfig()
+	for _, op := range []ServerOption{
+		ServerReadTimeout(0),
+		ServerReadHeaderTimeout(0),
+		ServerWriteTimeout(0),
+		ServerIdleTimeout(0),
+		ServerMaxHeaderBytes(0),
+		ServerShutdownTimeout(0),
+	} {
+		op(&config)
+	}
+
+	assert.Equal(t, time.Duration(0), config.readTimeout)
+	assert.Equal(t, time.Duration(0), config.readHeaderTimeout)
+	assert.Equal(t, time.Duration(0), config.writeTimeout)
+	assert.Equal(t, time.Duration(0), config.idleTimeout)
+	assert.Equal(t, 0, config.maxHeaderBytes)
+	assert.Equal(t, time.Duration(0), config.shutdownTimeout)
+}
+
+func TestRunTLSWithoutCertificate(t *testing.T) {
+	rtr := NewRouter()
+	err := rtr.RunTLS("127.0.0.1:0", "", "")
+	assert.Error(t, err)
+}
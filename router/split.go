@@ -0,0 +1,234 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Variant is a handler taking a share of the traffic of a split route,
+// proportional to its Weight.
+type Variant struct {
+	Name    string
+	Handler http.Handler
+	Weight  int
+}
+
+type SplitOption func(*splitter)
+
+type splitter struct {
+	variants []Variant
+	total    int
+
+	cookie         string
+	cookieMaxAge   time.Duration
+	key            func(r *http.Request) string
+	overrideHeader string
+	responseHeader string
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+const (
+	// DefaultSplitOverrideHeader is the request header forcing a variant.
+	DefaultSplitOverrideHeader = "X-Canary"
+	// DefaultSplitResponseHeader is the response header naming the variant
+	// that served the request.
+	DefaultSplitResponseHeader = "X-Variant"
+)
+
+// SplitByCookie keeps a client on the variant it was first assigned, stored
+// in the cookie name for maxAge.
+func SplitByCookie(name string, maxAge time.Duration) SplitOption {
+	return func(s *splitter) {
+		s.cookie = name
+		s.cookieMaxAge = maxAge
+	}
+}
+
+// SplitByHeader assigns the variant from a hash of the value of header, so
+// that requests carrying the same value, e.g. a user id, get the same
+// variant.
+func SplitByHeader(header string) SplitOption {
+	return SplitByKey(func(r *http.Request) string {
+		return r.Header.Get(header)
+	})
+}
+
+// SplitByKey assigns the variant from a hash of the key returned by fn.
+// Requests for which fn returns "" are assigned at random.
+func SplitByKey(fn func(r *http.Request) string) SplitOption {
+	return func(s *splitter) {
+		s.key = fn
+	}
+}
+
+// SplitOverrideHeader sets the request header forcing a variant,
+// DefaultSplitOverrideHeader by default. Its value is the name of a variant,
+// or 1 or true for the second variant and 0 or false for the first one.
+// An empty name disables overrides.
+func SplitOverrideHeader(header string) SplitOption {
+	return func(s *splitter) {
+		s.overrideHeader = header
+	}
+}
+
+// SplitResponseHeader sets the response header naming the variant,
+// DefaultSplitResponseHeader by default. An empty name disables it.
+func SplitResponseHeader(header string) SplitOption {
+	return func(s *splitter) {
+		s.responseHeader = header
+	}
+}
+
+// Split serves path with several variants of a handler, each one taking a
+// share of the requests by its weight; the first variant is the primary
+// one. Without a sticky option, each request is assigned at random.
+//
+// The name of the variant serving a request is available to the handler
+// through VariantFromContext and set in the response headers, where the
+// middlewares of the route can read it once the handler returns. Invalid
+// variants are reported by Build.
+func (rt *Route) Split(path string, variants []Variant, options ...SplitOption) {
+	s := &splitter{
+		variants:       variants,
+		overrideHeader: DefaultSplitOverrideHeader,
+		responseHeader: DefaultSplitResponseHeader,
+		rnd:            rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, op := range options {
+		op(s)
+	}
+
+	rt.path = path
+	rt.handler = s
+	if err := s.validate(); err != nil {
+		rt.err = fmt.Errorf("split route %s: %w", path, err)
+	}
+}
+
+func (s *splitter) validate() error {
+	if len(s.variants) == 0 {
+		return fmt.Errorf("no variants")
+	}
+
+	names := map[string]bool{}
+	for _, v := range s.variants {
+		switch {
+		case v.Name == "":
+			return fmt.Errorf("variant without a name")
+		case names[v.Name]:
+			return fmt.Errorf("variant %s given twice", v.Name)
+		case v.Handler == nil:
+			return fmt.Errorf("no handler for variant %s", v.Name)
+		case v.Weight < 0:
+			return fmt.Errorf("negative weight for variant %s", v.Name)
+		}
+		names[v.Name] = true
+		s.total += v.Weight
+	}
+
+	if s.total == 0 {
+		return fmt.Errorf("variants have no weight")
+	}
+	return nil
+}
+
+func (s *splitter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v, fromCookie := s.assign(r)
+
+	if s.cookie != "" && !fromCookie {
+		http.SetCookie(w, &http.Cookie{
+			Name:     s.cookie,
+			Value:    v.Name,
+			Path:     "/",
+			MaxAge:   int(s.cookieMaxAge / time.Second),
+			HttpOnly: true,
+		})
+	}
+	if s.responseHeader != "" {
+		w.Header().Set(s.responseHeader, v.Name)
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), ContextKeyVariant, v.Name))
+	v.Handler.ServeHTTP(w, r)
+}
+
+// assign picks the variant of r and reports whether it was read from the
+// sticky cookie.
+func (s *splitter) assign(r *http.Request) (*Variant, bool) {
+	if s.overrideHeader != "" {
+		if v := s.override(r.Header.Get(s.overrideHeader)); v != nil {
+			return v, false
+		}
+	}
+
+	if s.cookie != "" {
+		if c, err := r.Cookie(s.cookie); err == nil {
+			if v := s.byName(c.Value); v != nil && v.Weight > 0 {
+				return v, true
+			}
+		}
+	}
+
+	if s.key != nil {
+		if key := s.key(r); key != "" {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(key))
+			return s.pick(int(h.Sum32() % uint32(s.total))), false
+		}
+	}
+
+	s.mu.Lock()
+	n := s.rnd.Intn(s.total)
+	s.mu.Unlock()
+	return s.pick(n), false
+}
+
+func (s *splitter) override(value string) *Variant {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return nil
+	case "1", "true":
+		if len(s.variants) > 1 {
+			return &s.variants[1]
+		}
+		return nil
+	case "0", "false":
+		return &s.variants[0]
+	}
+	return s.byName(value)
+}
+
+func (s *splitter) byName(name string) *Variant {
+	for i := range s.variants {
+		if s.variants[i].Name == name {
+			return &s.variants[i]
+		}
+	}
+	return nil
+}
+
+// pick returns the variant holding the bucket n of [0, total).
+func (s *splitter) pick(n int) *Variant {
+	for i := range s.variants {
+		if n < s.variants[i].Weight {
+			return &s.variants[i]
+		}
+		n -= s.variants[i].Weight
+	}
+	return &s.variants[len(s.variants)-1]
+}
+
+// VariantFromContext returns the name of the variant serving a request of a
+// split route.
+func VariantFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(ContextKeyVariant).(string)
+	return name
+}
@@ -0,0 +1,107 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+func TestSplit(t *testing.T) {
+	variant := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+"="+VariantFromContext(r.Context()))
+		})
+	}
+
+	var seen []string
+	rtr := NewRouter()
+	rtr.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			seen = append(seen, w.Header().Get(DefaultSplitResponseHeader))
+		})
+	})
+	variants := []Variant{
+		{Name: "stable", Handler: variant("stable"), Weight: 90},
+		{Name: "canary", Handler: variant("canary"), Weight: 10},
+	}
+	rtr.Methods(http.MethodGet).Split("/cookie", variants, SplitByCookie("variant", time.Hour))
+	rtr.Methods(http.MethodGet).Split("/header", variants, SplitByHeader("X-User"))
+	rtr.Methods(http.MethodGet).Split("/random", []Variant{
+		{Name: "a", Handler: variant("a"), Weight: 1},
+		{Name: "b", Handler: variant("b"), Weight: 0},
+	})
+
+	serve := func(path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// sticky by cookie: the assigned variant is kept
+	rec := serve("/cookie")
+	cookies := rec.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assigned := cookies[0].Value
+	assert.Equal(t, assigned+"="+assigned, rec.Body.String())
+	assert.Equal(t, 3600, cookies[0].MaxAge)
+	for i := 0; i < 5; i++ {
+		rec = serve("/cookie", "Cookie", "variant="+assigned)
+		assert.Equal(t, assigned+"="+assigned, rec.Body.String())
+		assert.Empty(t, rec.Result().Cookies())
+	}
+
+	rec = serve("/cookie", "Cookie", "variant=stable", DefaultSplitOverrideHeader, "1")
+	assert.Equal(t, "canary=canary", rec.Body.String())
+	rec = serve("/cookie", DefaultSplitOverrideHeader, "stable")
+	assert.Equal(t, "stable=stable", rec.Body.String())
+
+	// sticky by header hash
+	first := serve("/header", "X-User", "42").Body.String()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, serve("/header", "X-User", "42").Body.String())
+	}
+
+	// a variant without weight is only served when forced
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "a=a", serve("/random").Body.String())
+	}
+	assert.Equal(t, "b=b", serve("/random", DefaultSplitOverrideHeader, "true").Body.String())
+	assert.Equal(t, "b", seen[len(seen)-1])
+}
+
+func TestSplitDistribution(t *testing.T) {
+	counts := map[string]int{}
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { counts[name]++ })
+	}
+
+	rtr := NewRouter()
+	rtr.Methods(http.MethodGet).Split("/", []Variant{
+		{Name: "a", Handler: handler("a"), Weight: 3},
+		{Name: "b", Handler: handler("b"), Weight: 1},
+	})
+
+	for i := 0; i < 4000; i++ {
+		rtr.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	assert.InDelta(t, 3000, counts["a"], 200)
+	assert.InDelta(t, 1000, counts["b"], 200)
+}
+
+func TestSplitInvalid(t *testing.T) {
+	rtr := NewRouter()
+	rtr.Methods(http.MethodGet).Split("/", []Variant{
+		{Name: "a", Handler: http.NotFoundHandler(), Weight: 1},
+		{Name: "a", Handler: http.NotFoundHandler(), Weight: 1},
+	})
+	assert.EqualError(t, rtr.Build(), "split route /: variant a given twice")
+}
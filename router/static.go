@@ -0,0 +1,333 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	gohttp "github.com/likearthian/go-http"
+)
+
+const staticFilepathParam = "filepath"
+
+type StaticOption func(*staticConfig)
+
+type cacheControlRule struct {
+	pattern string
+	value   string
+}
+
+type staticConfig struct {
+	indexFiles     []string
+	listDirectory  bool
+	spaFallback    string
+	precompressed  bool
+	cacheControls  []cacheControlRule
+	defaultControl string
+}
+
+// StaticIndexFiles defines the files served for a directory request.
+// Optional. Default value []string{"index.html"}.
+func StaticIndexFiles(names ...string) StaticOption {
+	return func(c *staticConfig) {
+		c.indexFiles = names
+	}
+}
+
+// StaticDirectoryListing enables an html listing for directories without an
+// index file.
+// Optional. Default value false.
+func StaticDirectoryListing(enable bool) StaticOption {
+	return func(c *staticConfig) {
+		c.listDirectory = enable
+	}
+}
+
+// StaticSPAFallback serves file, typically "/index.html", for every GET or
+// HEAD request that does not match an existing file, so a single page app
+// can handle its own routes.
+// Optional. Default value "" (disabled).
+func StaticSPAFallback(file string) StaticOption {
+	return func(c *staticConfig) {
+		c.spaFallback = file
+	}
+}
+
+// StaticPrecompressed serves the "<name>.gz" sibling of a file, when it exists
+// and the client accepts gzip.
+// Optional. Default value true.
+func StaticPrecompressed(enable bool) StaticOption {
+	return func(c *staticConfig) {
+		c.precompressed = enable
+	}
+}
+
+// StaticCacheControl sets the Cache-Control value for files matching
+// pattern. The pattern uses path.Match syntax and is matched against the
+// file path, then against the base name. Rules are tried in the order they
+// were added; a pattern "*" acts as the default.
+func StaticCacheControl(pattern, value string) StaticOption {
+	return func(c *staticConfig) {
+		if pattern == "*" {
+			c.defaultControl = value
+			return
+		}
+		c.cacheControls = append(c.cacheControls, cacheControlRule{pattern: pattern, value: value})
+	}
+}
+
+// Static serves the files of fs under prefix for GET and HEAD requests.
+// Responses carry a strong ETag and Last-Modified, and conditional and Range
+// requests are answered by http.ServeContent. With an empty or "/" prefix the
+// files are served for the GET and HEAD requests of every path under the
+// prefix of rtr not matched by another route.
+func (rtr *Router) Static(prefix string, fs http.FileSystem, options ...StaticOption) {
+	config := staticConfig{
+		indexFiles:    []string{"index.html"},
+		precompressed: true,
+	}
+	for _, op := range options {
+		op(&config)
+	}
+
+	handler := &staticHandler{
+		fs:     fs,
+		config: config,
+		prefix: rtr.prefix + strings.TrimSuffix(prefix, "/"),
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		rtr.setFallback(handler, []string{http.MethodGet, http.MethodHead}, rtr.prefix+"/*"+staticFilepathParam)
+		return
+	}
+
+	rtr.Methods(http.MethodGet, http.MethodHead).Handler(prefix+"/*"+staticFilepathParam, handler)
+}
+
+type staticHandler struct {
+	fs     http.FileSystem
+	config staticConfig
+	prefix string
+	etags  sync.Map
+}
+
+type staticETag struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+func (s *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName(staticFilepathParam)
+	if name == "" {
+		name = strings.TrimPrefix(r.URL.Path, s.prefix)
+	}
+	name = path.Clean("/" + name)
+
+	if s.serve(w, r, name, true) {
+		return
+	}
+
+	if s.config.spaFallback != "" && s.serve(w, r, path.Clean("/"+s.config.spaFallback), false) {
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// serve writes the file or directory at name and reports whether it existed.
+func (s *staticHandler) serve(w http.ResponseWriter, r *http.Request, name string, allowDir bool) bool {
+	f, err := s.fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if !info.IsDir() {
+		s.serveFile(w, r, name, f, info)
+		return true
+	}
+
+	if !allowDir {
+		return false
+	}
+
+	for _, index := range s.config.indexFiles {
+		indexName := path.Join(name, index)
+		ff, err := s.fs.Open(indexName)
+		if err != nil {
+			continue
+		}
+		defer ff.Close()
+
+		fi, err := ff.Stat()
+		if err != nil || fi.IsDir() {
+			continue
+		}
+
+		s.serveFile(w, r, indexName, ff, fi)
+		return true
+	}
+
+	if !s.config.listDirectory {
+		return false
+	}
+
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+		return true
+	}
+
+	s.listDirectory(w, f)
+	return true
+}
+
+func (s *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, f http.File, info os.FileInfo) {
+	content, contentInfo := f, info
+
+	if s.config.precompressed && acceptsGzip(r.Header.Get(gohttp.HeaderAcceptEncoding)) {
+		if gz, err := s.fs.Open(name + ".gz"); err == nil {
+			defer gz.Close()
+			if gzInfo, err := gz.Stat(); err == nil && !gzInfo.IsDir() {
+				content, contentInfo = gz, gzInfo
+				w.Header().Set(gohttp.HeaderContentEncoding, "gzip")
+			}
+		}
+	}
+
+	if s.config.precompressed {
+		w.Header().Add(gohttp.HeaderVary, gohttp.HeaderAcceptEncoding)
+	}
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set(gohttp.HeaderContentType, ctype)
+	} else if content != f {
+		// never sniff the content type from the compressed bytes
+		w.Header().Set(gohttp.HeaderContentType, "application/octet-stream")
+	}
+
+	if cc := s.cacheControl(name); cc != "" {
+		w.Header().Set(gohttp.HeaderCacheControl, cc)
+	}
+
+	key := name
+	if content != f {
+		key = name + ".gz"
+	}
+
+	etag, err := s.etag(key, content, contentInfo)
+	if err == nil {
+		w.Header().Set(gohttp.HeaderETag, etag)
+	}
+
+	http.ServeContent(w, r, name, contentInfo.ModTime(), content)
+}
+
+// etag returns a strong ETag built from the sha256 of the file content. It
+// is cached until the modification time or size of the file changes.
+func (s *staticHandler) etag(key string, f http.File, info os.FileInfo) (string, error) {
+	if v, ok := s.etags.Load(key); ok {
+		cached := v.(staticETag)
+		if cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+			return cached.etag, nil
+		}
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.Store(key, staticETag{modTime: info.ModTime(), size: info.Size(), etag: etag})
+
+	return etag, nil
+}
+
+func (s *staticHandler) cacheControl(name string) string {
+	rel := strings.TrimPrefix(name, "/")
+	for _, rule := range s.config.cacheControls {
+		if ok, _ := path.Match(strings.TrimPrefix(rule.pattern, "/"), rel); ok {
+			return rule.value
+		}
+		if ok, _ := path.Match(rule.pattern, path.Base(name)); ok {
+			return rule.value
+		}
+	}
+
+	return s.config.defaultControl
+}
+
+func (s *staticHandler) listDirectory(w http.ResponseWriter, f http.File) {
+	entries, err := f.Readdir(-1)
+	if err != nil {
+		http.Error(w, "error reading directory", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	w.Header().Set(gohttp.HeaderContentType, gohttp.HttpContentTypeHtml+"; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip with a
+// non-zero quality.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		enc := strings.ToLower(strings.TrimSpace(fields[0]))
+		if enc != "gzip" && enc != "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		return q > 0
+	}
+
+	return false
+}
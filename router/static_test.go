@@ -0,0 +1,182 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/tj/assert"
+)
+
+func newStaticTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("console.log('app')"))
+	_ = zw.Close()
+
+	files := map[string][]byte{
+		"index.html":       []byte("<html>app</html>"),
+		"assets/app.js":    []byte("console.log('app')"),
+		"assets/app.js.gz": gz.Bytes(),
+		"docs/readme.txt":  []byte("0123456789"),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestStatic(t *testing.T) {
+	dir := newStaticTestDir(t)
+	defer os.RemoveAll(dir)
+
+	rtr := NewRouter()
+	rtr.Methods(http.MethodGet).Handler("/api/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	}))
+	rtr.Static("/", http.Dir(dir),
+		StaticSPAFallback("index.html"),
+		StaticCacheControl("assets/*", "public, max-age=31536000, immutable"),
+		StaticCacheControl("*", "no-cache"),
+	)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(httptest.NewRequest(http.MethodGet, "/api/ping", nil))
+	assert.Equal(t, "pong", rec.Body.String())
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/assets/app.js", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "console.log('app')", rec.Body.String())
+	assert.Equal(t, "public, max-age=31536000, immutable", rec.Header().Get(gohttp.HeaderCacheControl))
+	etag := rec.Header().Get(gohttp.HeaderETag)
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, rec.Header().Get(gohttp.HeaderLastModified))
+
+	req := httptest.NewRequest(http.MethodGet, "/assets/app.js", nil)
+	req.Header.Set(gohttp.HeaderIfNoneMatch, etag)
+	rec = serve(req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/assets/app.js", nil)
+	req.Header.Set(gohttp.HeaderAcceptEncoding, "br, gzip;q=0.8")
+	rec = serve(req)
+	assert.Equal(t, "gzip", rec.Header().Get(gohttp.HeaderContentEncoding))
+	assert.Contains(t, rec.Header().Get(gohttp.HeaderContentType), "javascript")
+	assert.NotEqual(t, etag, rec.Header().Get(gohttp.HeaderETag))
+
+	req = httptest.NewRequest(http.MethodGet, "/docs/readme.txt", nil)
+	req.Header.Set(gohttp.HeaderRange, "bytes=2-4")
+	rec = serve(req)
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "234", rec.Body.String())
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/dashboard/settings", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<html>app</html>", rec.Body.String())
+	assert.Equal(t, "no-cache", rec.Header().Get(gohttp.HeaderCacheControl))
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	assert.Equal(t, "<html>app</html>", rec.Body.String())
+}
+
+func TestStaticPrefix(t *testing.T) {
+	dir := newStaticTestDir(t)
+	defer os.RemoveAll(dir)
+
+	rtr := NewRouter()
+	rtr.Static("/static", http.Dir(dir))
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/docs/readme.txt", nil))
+	assert.Equal(t, "0123456789", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/docs/", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/../go.mod", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestStaticFallbackScope(t *testing.T) {
+	dir := newStaticTestDir(t)
+	defer os.RemoveAll(dir)
+
+	rtr := NewRouter()
+	rtr.Methods(http.MethodPost).Handler("/api/orders", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	app := rtr.Subroute("/app")
+	app.Static("", http.Dir(dir), StaticSPAFallback("index.html"))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/app/dashboard")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<html>app</html>", rec.Body.String())
+	assert.Equal(t, "console.log('app')", serve(http.MethodGet, "/app/assets/app.js").Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/other/thing").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/application").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/api/typo").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/app/dashboard").Code)
+	assert.Empty(t, serve(http.MethodDelete, "/nothing").Header().Get(gohttp.HeaderAllow))
+
+	// a root fallback serves the requests the static files do not
+	rtr2 := NewRouter()
+	var patterns []string
+	rtr2.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			patterns = append(patterns, RoutePatternFromContext(r.Context()))
+			next.ServeHTTP(w, r)
+		})
+	})
+	rtr2.Subroute("/app").Static("", http.Dir(dir))
+	rtr2.Mount("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("legacy"))
+	}))
+	rec = httptest.NewRecorder()
+	rtr2.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/app/form", nil))
+	assert.Equal(t, "legacy", rec.Body.String())
+	rec = httptest.NewRecorder()
+	rtr2.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app/assets/app.js", nil))
+	assert.Equal(t, "console.log('app')", rec.Body.String())
+	// the fallbacks are served with their route pattern
+	assert.Equal(t, []string{"/*mountpath", "/app/*filepath"}, patterns)
+}
+
+func TestFallbackConflict(t *testing.T) {
+	dir := newStaticTestDir(t)
+	defer os.RemoveAll(dir)
+
+	rtr := NewRouter()
+	rtr.Static("/", http.Dir(dir))
+	rtr.Mount("", http.NotFoundHandler())
+	assert.Error(t, rtr.Build())
+}
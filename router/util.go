@@ -53,4 +53,33 @@ func matchSubdomain(domain, pattern string) bool {
 
 func NoopLogger(keyvals ...interface{}) error {
 	return nil
-}
\ No newline at end of file
+}
+
+// hasPathPrefix reports whether path lies under prefix, comparing whole
+// segments. Named parameters (:name) in prefix match any single segment and
+// a catch-all (*name) matches the rest of the path.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+
+	pathSegs := strings.Split(strings.Trim(path, "/"), "/")
+	prefixSegs := strings.Split(strings.Trim(prefix, "/"), "/")
+	for i, seg := range prefixSegs {
+		if strings.HasPrefix(seg, "*") {
+			return true
+		}
+		if i >= len(pathSegs) {
+			return false
+		}
+		if strings.HasPrefix(seg, ":") {
+			continue
+		}
+		if seg != pathSegs[i] {
+			return false
+		}
+	}
+
+	return true
+}
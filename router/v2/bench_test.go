@@ -0,0 +1,107 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v1 "github.com/likearthian/go-http/router"
+)
+
+var benchRoutes = []struct {
+	method string
+	path   string
+}{
+	{http.MethodGet, "/"},
+	{http.MethodGet, "/health"},
+	{http.MethodGet, "/users"},
+	{http.MethodPost, "/users"},
+	{http.MethodGet, "/users/{id}"},
+	{http.MethodPut, "/users/{id}"},
+	{http.MethodDelete, "/users/{id}"},
+	{http.MethodGet, "/users/{id}/orders"},
+	{http.MethodGet, "/users/{id}/orders/{order}"},
+	{http.MethodGet, "/orders/export"},
+	{http.MethodGet, "/orders/{id}"},
+	{http.MethodGet, "/repos/{owner}/{repo}/issues/{number}/comments"},
+	{http.MethodGet, "/static/{path...}"},
+}
+
+var benchRequests = map[string]string{
+	"Static":   "/orders/export",
+	"Param":    "/users/42",
+	"Params":   "/repos/likearthian/go-http/issues/12/comments",
+	"CatchAll": "/static/js/app/main.js",
+}
+
+func noopHandler(w http.ResponseWriter, r *http.Request) {}
+
+// toV1Path rewrites a v2 pattern into the httprouter syntax used by v1.
+func toV1Path(pattern string) string {
+	segs := strings.Split(pattern, "/")
+	for i, s := range segs {
+		if !strings.HasPrefix(s, "{") {
+			continue
+		}
+		name := strings.Trim(s, "{}")
+		if strings.HasSuffix(name, "...") {
+			segs[i] = "*" + strings.TrimSuffix(name, "...")
+		} else {
+			segs[i] = ":" + name
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func newBenchV2() http.Handler {
+	mx := NewRouter()
+	for _, r := range benchRoutes {
+		mx.Methods(r.method).Handler(r.path, http.HandlerFunc(noopHandler))
+	}
+	return mx
+}
+
+func newBenchV1(b *testing.B) http.Handler {
+	rtr := v1.NewRouter()
+	for _, r := range benchRoutes {
+		// httprouter does not allow a param next to a static segment
+		if r.path == "/orders/{id}" {
+			continue
+		}
+		rtr.Methods(r.method).Handler(toV1Path(r.path), http.HandlerFunc(noopHandler))
+	}
+	if err := rtr.Build(); err != nil {
+		b.Fatal(err)
+	}
+	return rtr
+}
+
+func benchmarkRouter(b *testing.B, h http.Handler, path string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkRouterV1(b *testing.B) {
+	h := newBenchV1(b)
+	for name, path := range benchRequests {
+		b.Run(name, func(b *testing.B) {
+			benchmarkRouter(b, h, path)
+		})
+	}
+}
+
+func BenchmarkRouterV2(b *testing.B) {
+	h := newBenchV2()
+	for name, path := range benchRequests {
+		b.Run(name, func(b *testing.B) {
+			benchmarkRouter(b, h, path)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+// BindParams fills the path tagged fields of the struct pointed by dest with
+// the path params of the matched route. Typed params are assigned directly
+// when the field type allows it, e.g. a {day:date} param to a time.Time
+// field; other params are converted with the rules of gohttp.BindURLQuery.
+func BindParams(ctx context.Context, dest interface{}) error {
+	params := GetParamsFromContext(ctx)
+	if len(params) == 0 {
+		return nil
+	}
+
+	val := reflect.ValueOf(dest)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return errors.New("destination is not a pointer to struct")
+	}
+
+	assigned := map[string]bool{}
+	if elem := val.Elem(); elem.Kind() == reflect.Struct {
+		typ := elem.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			name := typ.Field(i).Tag.Get("path")
+			field := elem.Field(i)
+			if name == "" || !field.CanSet() {
+				continue
+			}
+
+			for _, p := range params {
+				if p.Key != name || p.typed == nil {
+					continue
+				}
+				if tv := reflect.ValueOf(p.typed); tv.Type().AssignableTo(field.Type()) {
+					field.Set(tv)
+					assigned[name] = true
+				}
+				break
+			}
+		}
+	}
+
+	values := url.Values{}
+	for _, p := range params {
+		if !assigned[p.Key] {
+			values.Add(p.Key, p.Value)
+		}
+	}
+
+	return gohttp.BindPathParams(dest, values)
+}
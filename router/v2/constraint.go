@@ -0,0 +1,72 @@
+package route
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// paramConstraint restricts the segments a param matches, and converts the
+// matching segment into a typed value.
+type paramConstraint struct {
+	name  string
+	match func(value string) (interface{}, bool)
+}
+
+// DateLayout is the layout of the date param type.
+const DateLayout = "2006-01-02"
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// paramTypes are the named constraints. Any other constraint is compiled as
+// a regular expression that must match the whole segment.
+var paramTypes = map[string]func(value string) (interface{}, bool){
+	// int matches a signed integer, typed as int64
+	"int": func(value string) (interface{}, bool) {
+		v, err := strconv.ParseInt(value, 10, 64)
+		return v, err == nil
+	},
+	// uint matches an unsigned integer, typed as uint64
+	"uint": func(value string) (interface{}, bool) {
+		v, err := strconv.ParseUint(value, 10, 64)
+		return v, err == nil
+	},
+	// float matches a decimal number, typed as float64
+	"float": func(value string) (interface{}, bool) {
+		v, err := strconv.ParseFloat(value, 64)
+		return v, err == nil
+	},
+	// bool matches the values accepted by strconv.ParseBool
+	"bool": func(value string) (interface{}, bool) {
+		v, err := strconv.ParseBool(value)
+		return v, err == nil
+	},
+	// date matches a date in DateLayout, typed as time.Time
+	"date": func(value string) (interface{}, bool) {
+		v, err := time.Parse(DateLayout, value)
+		return v, err == nil
+	},
+	// uuid matches a canonical uuid, typed as string
+	"uuid": func(value string) (interface{}, bool) {
+		return value, uuidPattern.MatchString(value)
+	},
+}
+
+func newParamConstraint(constraint string) (*paramConstraint, error) {
+	if fn, ok := paramTypes[constraint]; ok {
+		return &paramConstraint{name: constraint, match: fn}, nil
+	}
+
+	re, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint %q: %w", constraint, err)
+	}
+
+	return &paramConstraint{
+		name: constraint,
+		match: func(value string) (interface{}, bool) {
+			return value, re.MatchString(value)
+		},
+	}, nil
+}
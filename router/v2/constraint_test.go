@@ -0,0 +1,70 @@
+package route
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tj/assert"
+)
+
+func TestConstrainedParams(t *testing.T) {
+	mx := NewRouter()
+	mx.Methods(http.MethodGet).Handler("/orders/{id:int}", writePattern("order"))
+	mx.Methods(http.MethodGet).Handler("/orders/export", writePattern("export"))
+	mx.Methods(http.MethodGet).Handler("/orders/{code:[A-Z]{3}-[0-9]+}", writePattern("code"))
+	mx.Methods(http.MethodGet).Handler("/orders/{name}", writePattern("name"))
+	mx.Methods(http.MethodGet).Handler("/reports/{day:date}", writePattern("report"))
+
+	tests := []struct {
+		path string
+		body string
+		code int
+	}{
+		{"/orders/42", "order id=42", http.StatusOK},
+		{"/orders/export", "export", http.StatusOK},
+		{"/orders/ABC-12", "code code=ABC-12", http.StatusOK},
+		{"/orders/abc", "name name=abc", http.StatusOK},
+		{"/reports/2021-03-04", "report day=2021-03-04", http.StatusOK},
+		{"/reports/yesterday", "404 page not found\n", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		rec := serve(mx, http.MethodGet, test.path)
+		assert.Equal(t, test.code, rec.Code, test.path)
+		assert.Equal(t, test.body, rec.Body.String(), test.path)
+	}
+
+	assert.Panics(t, func() {
+		mx.Methods(http.MethodGet).Handler("/items/{id:[0-9}", writePattern("invalid"))
+	})
+}
+
+func TestTypedParams(t *testing.T) {
+	type request struct {
+		ID     int64     `path:"id"`
+		Day    time.Time `path:"day"`
+		Slug   string    `path:"slug"`
+		Amount int       `path:"amount"`
+	}
+
+	var got request
+	var id int64
+	var day time.Time
+	mx := NewRouter()
+	mx.Methods(http.MethodGet).Handler("/shops/{slug:[a-z-]+}/orders/{id:int}/{day:date}/{amount:int}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ = IntParamFromContext(r.Context(), "id")
+		day, _ = DateParamFromContext(r.Context(), "day")
+		if err := BindParams(r.Context(), &got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+
+	rec := serve(mx, http.MethodGet, "/shops/corner-shop/orders/17/2021-03-04/250")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	expectedDay := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, int64(17), id)
+	assert.Equal(t, expectedDay, day)
+	assert.Equal(t, request{ID: 17, Day: expectedDay, Slug: "corner-shop", Amount: 250}, got)
+}
@@ -0,0 +1,137 @@
+package route
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type contextKey int
+
+const (
+	// routeContextKey holds the *routeContext of a request being routed.
+	routeContextKey contextKey = iota
+)
+
+// Param is a single path parameter, consisting of a key and a value.
+type Param struct {
+	Key   string
+	Value string
+
+	// value converted by the type constraint of the param
+	typed interface{}
+}
+
+// Params is the list of path parameters of a matched route, in the order
+// they appear in the pattern.
+type Params []Param
+
+// ByName returns the value of the first Param which key matches the given
+// name. If no matching Param is found, an empty string is returned.
+func (ps Params) ByName(name string) string {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// Typed returns the value of the first Param which key matches the given
+// name, converted by its type constraint: int64 for int, uint64 for uint,
+// float64 for float, bool for bool and time.Time for date. Params without
+// a type constraint are returned as string.
+func (ps Params) Typed(name string) (interface{}, bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			if p.typed != nil {
+				return p.typed, true
+			}
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+// routeContext carries the routing state of a request across mounted
+// routers.
+type routeContext struct {
+	// path left to be matched by the next router
+	path     string
+	params   Params
+	patterns []string
+	// matches are the searches made by the root Mux ahead of routing, one
+	// per router level, for the routers to reuse
+	matches  []routeMatch
+	matchBuf [2]routeMatch
+}
+
+// routeMatch is the search of path and method by a Mux.
+type routeMatch struct {
+	mux    *Mux
+	method string
+	path   string
+	found  bool
+	res    searchResult
+}
+
+func getRouteContext(ctx context.Context) *routeContext {
+	rctx, _ := ctx.Value(routeContextKey).(*routeContext)
+	return rctx
+}
+
+// GetParamsFromContext returns the path params of the matched route,
+// including the ones captured by parent routers.
+func GetParamsFromContext(ctx context.Context) Params {
+	rctx := getRouteContext(ctx)
+	if rctx == nil {
+		return nil
+	}
+	return rctx.params
+}
+
+// RoutePatternFromContext returns the full pattern of the matched route,
+// e.g. "/api/users/{id}", or "" when no route matched.
+func RoutePatternFromContext(ctx context.Context) string {
+	rctx := getRouteContext(ctx)
+	if rctx == nil || len(rctx.patterns) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, p := range rctx.patterns {
+		if i < len(rctx.patterns)-1 {
+			p = strings.TrimSuffix(p, "/*")
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// IntParamFromContext returns the value of an {name:int} param.
+func IntParamFromContext(ctx context.Context, name string) (int64, bool) {
+	v, _ := GetParamsFromContext(ctx).Typed(name)
+	i, ok := v.(int64)
+	return i, ok
+}
+
+// UintParamFromContext returns the value of an {name:uint} param.
+func UintParamFromContext(ctx context.Context, name string) (uint64, bool) {
+	v, _ := GetParamsFromContext(ctx).Typed(name)
+	i, ok := v.(uint64)
+	return i, ok
+}
+
+// FloatParamFromContext returns the value of a {name:float} param.
+func FloatParamFromContext(ctx context.Context, name string) (float64, bool) {
+	v, _ := GetParamsFromContext(ctx).Typed(name)
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// DateParamFromContext returns the value of a {name:date} param.
+func DateParamFromContext(ctx context.Context, name string) (time.Time, bool) {
+	v, _ := GetParamsFromContext(ctx).Typed(name)
+	t, ok := v.(time.Time)
+	return t, ok
+}
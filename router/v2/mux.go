@@ -0,0 +1,338 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+var _ Router = (*Mux)(nil)
+
+// Mux is a Router backed by its own radix tree. Patterns are made of static
+// segments, {param} segments matching a single path segment and a trailing
+// {rest...} segment matching the remainder of the path. Params may carry a
+// type or regular expression constraint, {id:int} or {slug:[a-z-]+}, and a
+// segment failing the constraint falls through to the next candidate. When
+// several routes match, static segments win over params, constrained params
+// over unconstrained ones, and params over catch-alls.
+type Mux struct {
+	tree             *node
+	middlewares      []MiddlewareFunc
+	routes           []*Route
+	handler          http.Handler
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+func NewRouter() *Mux {
+	mx := &Mux{
+		tree:        &node{},
+		middlewares: []MiddlewareFunc{},
+		routes:      []*Route{},
+	}
+	mx.handler = http.HandlerFunc(mx.routeHTTP)
+	return mx
+}
+
+// Use appends middlewares to the chain wrapping every route of the router,
+// including the routes of mounted routers.
+func (mx *Mux) Use(middlewares ...MiddlewareFunc) {
+	mx.middlewares = append(mx.middlewares, middlewares...)
+
+	var handler http.Handler = http.HandlerFunc(mx.routeHTTP)
+	for i := len(mx.middlewares) - 1; i >= 0; i-- {
+		handler = mx.middlewares[i](handler)
+	}
+	mx.handler = handler
+}
+
+// Methods starts a route for methods. A route without methods serves every
+// method.
+func (mx *Mux) Methods(methods ...string) *Route {
+	return &Route{
+		mux:     mx,
+		methods: methods,
+	}
+}
+
+// Handler registers handler for pattern. It panics when pattern is invalid
+// or when a handler is already registered for one of the methods.
+func (rt *Route) Handler(pattern string, handler http.Handler) {
+	if rt.mux == nil {
+		panic("route: Handler called on a Route not created by Methods")
+	}
+
+	route := rt.mux.handle(rt.methods, pattern, handler, rt.meta)
+	rt.Pattern = route.Pattern
+	rt.Handlers = route.Handlers
+	rt.Metadata = route.Metadata
+}
+
+// Meta attaches documentation metadata to the route. It must be called
+// before Handler.
+func (rt *Route) Meta(meta gohttp.RouteMetadata) *Route {
+	rt.meta = &meta
+	return rt
+}
+
+func (mx *Mux) handle(methods []string, pattern string, handler http.Handler, meta *gohttp.RouteMetadata) *Route {
+	if handler == nil {
+		panic(fmt.Sprintf("route: nil handler for %s", pattern))
+	}
+
+	n, err := mx.tree.insert(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("route: %s", err))
+	}
+	if n.mount {
+		panic(fmt.Sprintf("route: %s conflicts with a mounted router", pattern))
+	}
+
+	if n.handlers == nil {
+		n.handlers = make(map[string]http.Handler)
+		n.pattern = pattern
+		n.route = &Route{Pattern: pattern, Handlers: n.handlers, Metadata: map[string]*gohttp.RouteMetadata{}}
+		mx.routes = append(mx.routes, n.route)
+	}
+
+	if len(methods) == 0 {
+		methods = []string{methodAny}
+	}
+
+	for _, m := range methods {
+		m = strings.ToUpper(m)
+		if _, exists := n.handlers[m]; exists {
+			panic(fmt.Sprintf("route: handler for %s %s already registered", m, pattern))
+		}
+		n.handlers[m] = handler
+		if meta != nil {
+			n.route.Metadata[m] = meta
+		}
+	}
+
+	return n.route
+}
+
+// Mount serves handler for pattern and every path below it. A mounted Mux
+// matches its routes against the remainder of the path and sees the params
+// captured by the parent; any other handler gets r.URL.Path with the prefix
+// stripped.
+func (mx *Mux) Mount(pattern string, handler http.Handler) {
+	if handler == nil {
+		panic(fmt.Sprintf("route: nil handler mounted on %s", pattern))
+	}
+
+	pattern = strings.TrimSuffix(pattern, "/")
+	if _, ok := handler.(*Mux); !ok {
+		handler = stripPrefix(handler)
+	}
+
+	handlers := map[string]http.Handler{methodAny: handler}
+	mountPattern := pattern + "/*"
+
+	paths := []string{pattern + "/{*...}"}
+	if pattern != "" {
+		paths = append(paths, pattern)
+	}
+
+	for _, p := range paths {
+		n, err := mx.tree.insert(p)
+		if err != nil {
+			panic(fmt.Sprintf("route: %s", err))
+		}
+		if n.handlers != nil {
+			panic(fmt.Sprintf("route: mounting on %s conflicts with an existing route", pattern))
+		}
+		n.handlers = handlers
+		n.pattern = mountPattern
+		n.mount = true
+	}
+
+	var subRoutes Routes
+	if rs, ok := handler.(Routes); ok {
+		subRoutes = rs
+	}
+
+	mx.routes = append(mx.routes, &Route{Pattern: mountPattern, Handlers: handlers, SubRoutes: subRoutes})
+}
+
+// Subroute creates a router mounted under pattern.
+func (mx *Mux) Subroute(pattern string) Router {
+	sub := NewRouter()
+	sub.notFound = mx.notFound
+	sub.methodNotAllowed = mx.methodNotAllowed
+	mx.Mount(pattern, sub)
+	return sub
+}
+
+// NotFound sets the handler called when no route matches.
+// Optional. Default value http.NotFoundHandler().
+func (mx *Mux) NotFound(handler http.Handler) {
+	mx.notFound = handler
+}
+
+// MethodNotAllowed sets the handler called when a route matches the path
+// but not the method. The Allow header is set before it is called.
+// Optional. Default value replies 405 with a plain text body.
+func (mx *Mux) MethodNotAllowed(handler http.Handler) {
+	mx.methodNotAllowed = handler
+}
+
+// Routes returns the routes registered on the router, in registration order.
+func (mx *Mux) Routes() []Route {
+	routes := make([]Route, 0, len(mx.routes))
+	for _, r := range mx.routes {
+		routes = append(routes, *r)
+	}
+	return routes
+}
+
+func (mx *Mux) Middlewares() []MiddlewareFunc {
+	return mx.middlewares
+}
+
+func (mx *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if getRouteContext(r.Context()) == nil {
+		rctx := &routeContext{path: r.URL.Path}
+		rctx.matches = rctx.matchBuf[:0]
+		ctx := context.WithValue(r.Context(), routeContextKey, rctx)
+
+		// the route is resolved ahead of routing, so that the middlewares of
+		// the Mux see its pattern and metadata
+		if pattern, meta := mx.lookup(rctx, r.Method, r.URL.Path); pattern != "" {
+			ctx = gohttp.ContextWithRoutePattern(ctx, pattern)
+			if meta != nil {
+				ctx = gohttp.ContextWithRouteMetadata(ctx, meta)
+			}
+		}
+		r = r.WithContext(ctx)
+	}
+
+	mx.handler.ServeHTTP(w, r)
+}
+
+func (mx *Mux) routeHTTP(w http.ResponseWriter, r *http.Request) {
+	rctx := getRouteContext(r.Context())
+
+	res, found := mx.search(rctx, r.Method, rctx.path)
+	if !found {
+		if res.allowed != nil {
+			w.Header().Set("Allow", allowHeader(res.allowed))
+			if mx.methodNotAllowed != nil {
+				mx.methodNotAllowed.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if mx.notFound != nil {
+			mx.notFound.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	n := res.node
+	params := res.params
+	if n.mount {
+		rest := ""
+		if n.typ == ntCatchAll {
+			rest = params[len(params)-1].Value
+			params = params[:len(params)-1]
+		}
+		rctx.path = "/" + rest
+	}
+
+	rctx.patterns = append(rctx.patterns, n.pattern)
+	rctx.params = append(rctx.params, params...)
+	pattern := RoutePatternFromContext(r.Context())
+	gohttp.RecordRoutePattern(r.Context(), pattern)
+
+	handler := n.handler(r.Method)
+	// a mounted Mux sets the pattern and metadata of the route it matches
+	if _, ok := handler.(*Mux); !ok {
+		ctx := gohttp.ContextWithRoutePattern(r.Context(), pattern)
+		r = r.WithContext(gohttp.ContextWithRouteMetadata(ctx, n.metadata(r.Method)))
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// search matches method and path against the routes of mx, reusing the
+// search made by lookup for this router level when there is one.
+func (mx *Mux) search(rctx *routeContext, method, path string) (searchResult, bool) {
+	if depth := len(rctx.patterns); depth < len(rctx.matches) {
+		if m := rctx.matches[depth]; m.mux == mx && m.method == method && m.path == path {
+			return m.res, m.found
+		}
+	}
+
+	var res searchResult
+	found := mx.tree.search(method, path, &res)
+	return res, found
+}
+
+// lookup resolves the route serving method and path, descending into the
+// mounted routers, without serving it. It returns the full pattern of the
+// route and its metadata, or "" when no route matches. The searches are kept
+// in rctx for routeHTTP.
+func (mx *Mux) lookup(rctx *routeContext, method, path string) (string, *gohttp.RouteMetadata) {
+	var res searchResult
+	found := mx.tree.search(method, path, &res)
+	rctx.matches = append(rctx.matches, routeMatch{mux: mx, method: method, path: path, found: found, res: res})
+	if !found {
+		return "", nil
+	}
+
+	n := res.node
+	if !n.mount {
+		return n.pattern, n.metadata(method)
+	}
+
+	sub, ok := n.handler(method).(*Mux)
+	if !ok {
+		return n.pattern, nil
+	}
+	rest := "/"
+	if n.typ == ntCatchAll {
+		rest += res.params[len(res.params)-1].Value
+	}
+	pattern, meta := sub.lookup(rctx, method, rest)
+	if pattern == "" {
+		return "", nil
+	}
+	return strings.TrimSuffix(n.pattern, "/*") + pattern, meta
+}
+
+func allowHeader(handlers map[string]http.Handler) string {
+	methods := make([]string, 0, len(handlers))
+	for m := range handlers {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// stripPrefix hands the unmatched remainder of the path to a handler that
+// is not aware of the routing context.
+func stripPrefix(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rctx := getRouteContext(r.Context())
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = rctx.path
+		r2.URL.RawPath = ""
+
+		handler.ServeHTTP(w, r2)
+	})
+}
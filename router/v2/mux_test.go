@@ -0,0 +1,151 @@
+package route
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tj/assert"
+)
+
+func writePattern(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name)
+		for _, p := range GetParamsFromContext(r.Context()) {
+			_, _ = io.WriteString(w, " "+p.Key+"="+p.Value)
+		}
+	})
+}
+
+func serve(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestMuxPriority(t *testing.T) {
+	mx := NewRouter()
+	mx.Methods(http.MethodGet).Handler("/orders/export", writePattern("export"))
+	mx.Methods(http.MethodGet).Handler("/orders/exports", writePattern("exports"))
+	mx.Methods(http.MethodGet).Handler("/orders/{id}", writePattern("order"))
+	mx.Methods(http.MethodGet).Handler("/orders/{id}/items/{item}", writePattern("item"))
+	mx.Methods(http.MethodGet).Handler("/orders/{id}/{rest...}", writePattern("rest"))
+	mx.Methods(http.MethodGet).Handler("/files/{path...}", writePattern("files"))
+	mx.Methods(http.MethodGet).Handler("/", writePattern("root"))
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/", "root"},
+		{"/orders/export", "export"},
+		{"/orders/exports", "exports"},
+		{"/orders/expo", "order id=expo"},
+		{"/orders/42", "order id=42"},
+		{"/orders/42/items/7", "item id=42 item=7"},
+		{"/orders/42/items", "rest id=42 rest=items"},
+		{"/orders/42/notes/1/2", "rest id=42 rest=notes/1/2"},
+		{"/files/", "files path="},
+		{"/files/a/b.txt", "files path=a/b.txt"},
+	}
+
+	for _, test := range tests {
+		rec := serve(mx, http.MethodGet, test.path)
+		assert.Equal(t, http.StatusOK, rec.Code, test.path)
+		assert.Equal(t, test.body, rec.Body.String(), test.path)
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve(mx, http.MethodGet, "/orders").Code)
+	assert.Equal(t, http.StatusNotFound, serve(mx, http.MethodGet, "/orders/").Code)
+}
+
+func TestMuxMethods(t *testing.T) {
+	mx := NewRouter()
+	mx.Methods(http.MethodGet).Handler("/users/{id}", writePattern("get"))
+	mx.Methods(http.MethodPut, http.MethodPatch).Handler("/users/{id}", writePattern("update"))
+	mx.Methods().Handler("/any", writePattern("any"))
+
+	assert.Equal(t, "get id=1", serve(mx, http.MethodGet, "/users/1").Body.String())
+	assert.Equal(t, "update id=1", serve(mx, http.MethodPatch, "/users/1").Body.String())
+	assert.Equal(t, "any", serve(mx, http.MethodDelete, "/any").Body.String())
+
+	rec := serve(mx, http.MethodDelete, "/users/1")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, PATCH, PUT", rec.Header().Get("Allow"))
+
+	assert.Panics(t, func() {
+		mx.Methods(http.MethodGet).Handler("/users/{id}", writePattern("duplicate"))
+	})
+	assert.Panics(t, func() {
+		mx.Methods(http.MethodGet).Handler("/users/{name}/profile", writePattern("conflict"))
+	})
+}
+
+func TestMuxSubroutes(t *testing.T) {
+	var chain []string
+	mw := func(name string) MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				chain = append(chain, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	mx := NewRouter()
+	mx.Use(mw("root"))
+
+	tenants := mx.Subroute("/tenants/{tenant}")
+	tenants.Use(mw("tenants"))
+	tenants.Methods(http.MethodGet).Handler("/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := GetParamsFromContext(r.Context())
+		_, _ = io.WriteString(w, RoutePatternFromContext(r.Context())+" "+params.ByName("tenant")+" "+params.ByName("id"))
+	}))
+
+	mx.Mount("/debug", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "debug "+r.URL.Path)
+	}))
+
+	rec := serve(mx, http.MethodGet, "/tenants/acme/users/7")
+	assert.Equal(t, "/tenants/{tenant}/users/{id} acme 7", rec.Body.String())
+	assert.Equal(t, []string{"root", "tenants"}, chain)
+
+	assert.Equal(t, "debug /pprof/heap", serve(mx, http.MethodGet, "/debug/pprof/heap").Body.String())
+	assert.Equal(t, "debug /", serve(mx, http.MethodGet, "/debug").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(mx, http.MethodGet, "/tenants/acme/groups").Code)
+
+	routes := mx.Routes()
+	assert.Equal(t, 2, len(routes))
+	assert.Equal(t, "/tenants/{tenant}/*", routes[0].Pattern)
+	assert.NotNil(t, routes[0].SubRoutes)
+	assert.Equal(t, "/users/{id}", routes[0].SubRoutes.Routes()[0].Pattern)
+	assert.Equal(t, 1, len(routes[0].SubRoutes.Middlewares()))
+}
+
+func TestMuxRoutesRewrittenRequest(t *testing.T) {
+	mx := NewRouter()
+	// the method is rewritten after the route was resolved ahead of routing
+	mx.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if m := r.Header.Get("X-HTTP-Method-Override"); m != "" {
+				r2 := *r
+				r2.Method = m
+				r = &r2
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	api := mx.Subroute("/api")
+	api.Methods(http.MethodPost).Handler("/users/{id}", writePattern("post"))
+	api.Methods(http.MethodDelete).Handler("/users/{id}", writePattern("delete"))
+
+	assert.Equal(t, "post id=7", serve(mx, http.MethodPost, "/api/users/7").Body.String())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/7", nil)
+	req.Header.Set("X-HTTP-Method-Override", http.MethodDelete)
+	rec := httptest.NewRecorder()
+	mx.ServeHTTP(rec, req)
+	assert.Equal(t, "delete id=7", rec.Body.String())
+}
@@ -1,11 +1,355 @@
 package route
 
-import "net/http"
-
-// Route describes the details of a routing handler.
-// Handlers map key is an HTTP method
-type Route struct {
-	SubRoutes Routes
-	Handlers  map[string]http.Handler
-	Pattern   string
-}
\ No newline at end of file
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	gohttp "github.com/likearthian/go-http"
+)
+
+type nodeType uint8
+
+const (
+	ntStatic nodeType = iota
+	ntParam
+	ntCatchAll
+)
+
+// methodAny is the Handlers key of a handler serving every method.
+const methodAny = "*"
+
+// node is a node of the radix tree. Static nodes hold a compressed path
+// fragment; param and catch-all nodes hold the name of the parameter.
+// Children are matched in priority order: static, then param, then catch-all.
+type node struct {
+	typ    nodeType
+	label  byte
+	prefix string
+
+	static   []*node
+	params   []*node
+	catchAll *node
+
+	// constraint of a param node, nil when it matches any segment
+	constraint *paramConstraint
+
+	// route ending at this node, nil for inner nodes
+	handlers map[string]http.Handler
+	pattern  string
+	mount    bool
+	route    *Route
+}
+
+type segment struct {
+	typ        nodeType
+	value      string
+	constraint string
+}
+
+// parsePattern splits a pattern into static fragments and parameters.
+// Parameters are written {name} and match a single path segment; a trailing
+// {name...} matches the rest of the path. A param may be constrained with a
+// type or a regular expression, e.g. {id:int} or {slug:[a-z-]+}.
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern %q must begin with '/'", pattern)
+	}
+
+	var segs []segment
+	for len(pattern) > 0 {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			segs = append(segs, segment{typ: ntStatic, value: pattern})
+			break
+		}
+		if start > 0 {
+			segs = append(segs, segment{typ: ntStatic, value: pattern[:start]})
+		}
+		if start == 0 || pattern[start-1] != '/' {
+			return nil, fmt.Errorf("parameter in %q must be a whole path segment", pattern)
+		}
+
+		end := closingBrace(pattern, start)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed parameter in %q", pattern)
+		}
+
+		name := pattern[start+1 : end]
+		rest := pattern[end+1:]
+
+		constraint := ""
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name, constraint = name[:i], name[i+1:]
+			if constraint == "" {
+				return nil, fmt.Errorf("empty constraint for {%s} in %q", name, pattern)
+			}
+		}
+		if rest != "" && rest[0] != '/' {
+			return nil, fmt.Errorf("parameter in %q must be a whole path segment", pattern)
+		}
+
+		if strings.HasSuffix(name, "...") {
+			if rest != "" {
+				return nil, fmt.Errorf("catch-all parameter must be the last segment of %q", pattern)
+			}
+			if constraint != "" {
+				return nil, fmt.Errorf("catch-all parameter cannot be constrained in %q", pattern)
+			}
+			name = strings.TrimSuffix(name, "...")
+			segs = append(segs, segment{typ: ntCatchAll, value: name})
+		} else {
+			segs = append(segs, segment{typ: ntParam, value: name, constraint: constraint})
+		}
+
+		if name == "" {
+			return nil, fmt.Errorf("empty parameter name in %q", pattern)
+		}
+
+		pattern = rest
+	}
+
+	return segs, nil
+}
+
+// closingBrace returns the index of the brace closing the one at start,
+// allowing braces inside a regular expression constraint.
+func closingBrace(pattern string, start int) int {
+	depth := 0
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// insert adds the route described by pattern and returns its leaf node.
+func (n *node) insert(pattern string) (*node, error) {
+	segs, err := parsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	cur := n
+	for _, seg := range segs {
+		switch seg.typ {
+		case ntStatic:
+			cur = cur.insertStatic(seg.value)
+		case ntParam:
+			if cur, err = cur.insertParam(seg); err != nil {
+				return nil, fmt.Errorf("%s in %q", err, pattern)
+			}
+		case ntCatchAll:
+			if cur.catchAll == nil {
+				cur.catchAll = &node{typ: ntCatchAll, prefix: seg.value}
+			} else if cur.catchAll.prefix != seg.value {
+				return nil, fmt.Errorf("parameter {%s...} in %q conflicts with existing {%s...}", seg.value, pattern, cur.catchAll.prefix)
+			}
+			cur = cur.catchAll
+		}
+	}
+
+	return cur, nil
+}
+
+// insertParam returns the param child for seg. Params with the same
+// constraint share a node and must use the same name. Constrained params are
+// tried in registration order before the unconstrained one.
+func (n *node) insertParam(seg segment) (*node, error) {
+	for _, p := range n.params {
+		if p.constraintName() != seg.constraint {
+			continue
+		}
+		if p.prefix != seg.value {
+			return nil, fmt.Errorf("parameter {%s} conflicts with existing {%s}", seg.value, p.prefix)
+		}
+		return p, nil
+	}
+
+	child := &node{typ: ntParam, prefix: seg.value}
+	if seg.constraint != "" {
+		c, err := newParamConstraint(seg.constraint)
+		if err != nil {
+			return nil, err
+		}
+		child.constraint = c
+	}
+
+	// keep the unconstrained param last
+	if len(n.params) > 0 && n.params[len(n.params)-1].constraint == nil && child.constraint != nil {
+		last := n.params[len(n.params)-1]
+		n.params = append(n.params[:len(n.params)-1], child, last)
+	} else {
+		n.params = append(n.params, child)
+	}
+
+	return child, nil
+}
+
+func (n *node) constraintName() string {
+	if n.constraint == nil {
+		return ""
+	}
+	return n.constraint.name
+}
+
+func (n *node) insertStatic(s string) *node {
+	cur := n
+	for len(s) > 0 {
+		idx := -1
+		for i, c := range cur.static {
+			if c.label == s[0] {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 {
+			child := &node{typ: ntStatic, label: s[0], prefix: s}
+			cur.static = append(cur.static, child)
+			return child
+		}
+
+		child := cur.static[idx]
+		l := commonPrefix(child.prefix, s)
+		if l < len(child.prefix) {
+			split := &node{typ: ntStatic, label: child.prefix[0], prefix: child.prefix[:l]}
+			child.prefix = child.prefix[l:]
+			child.label = child.prefix[0]
+			split.static = []*node{child}
+			cur.static[idx] = split
+			child = split
+		}
+
+		s = s[l:]
+		cur = child
+	}
+
+	return cur
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// searchResult collects the outcome of a lookup. When a route matches the
+// path but not the method, its methods are kept to answer 405.
+type searchResult struct {
+	node    *node
+	params  Params
+	allowed map[string]http.Handler
+}
+
+func (n *node) search(method, path string, res *searchResult) bool {
+	if path == "" {
+		if n.handlers != nil {
+			if n.hasMethod(method) {
+				res.node = n
+				return true
+			}
+			if res.allowed == nil {
+				res.allowed = n.handlers
+			}
+		}
+		if n.catchAll != nil && n.catchAll.handlers != nil {
+			return n.catchAll.searchCatchAll(method, path, res)
+		}
+		return false
+	}
+
+	for _, c := range n.static {
+		if c.label != path[0] || !strings.HasPrefix(path, c.prefix) {
+			continue
+		}
+		if c.search(method, path[len(c.prefix):], res) {
+			return true
+		}
+		break
+	}
+
+	if len(n.params) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			value := path[:end]
+			for _, p := range n.params {
+				param := Param{Key: p.prefix, Value: value}
+				if p.constraint != nil {
+					typed, ok := p.constraint.match(value)
+					if !ok {
+						continue
+					}
+					param.typed = typed
+				}
+
+				res.params = append(res.params, param)
+				if p.search(method, path[end:], res) {
+					return true
+				}
+				res.params = res.params[:len(res.params)-1]
+			}
+		}
+	}
+
+	if n.catchAll != nil {
+		return n.catchAll.searchCatchAll(method, path, res)
+	}
+
+	return false
+}
+
+func (n *node) searchCatchAll(method, path string, res *searchResult) bool {
+	if n.handlers == nil {
+		return false
+	}
+	if !n.hasMethod(method) {
+		if res.allowed == nil {
+			res.allowed = n.handlers
+		}
+		return false
+	}
+
+	res.params = append(res.params, Param{Key: n.prefix, Value: path})
+	res.node = n
+	return true
+}
+
+func (n *node) hasMethod(method string) bool {
+	if _, ok := n.handlers[method]; ok {
+		return true
+	}
+	_, ok := n.handlers[methodAny]
+	return ok
+}
+
+func (n *node) handler(method string) http.Handler {
+	if h, ok := n.handlers[method]; ok {
+		return h
+	}
+	return n.handlers[methodAny]
+}
+
+// metadata returns the metadata of the handler serving method, nil for
+// mounts.
+func (n *node) metadata(method string) *gohttp.RouteMetadata {
+	if n.route == nil {
+		return nil
+	}
+	if _, ok := n.handlers[method]; ok {
+		return n.route.Metadata[method]
+	}
+	return n.route.Metadata[methodAny]
+}
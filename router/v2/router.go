@@ -1,6 +1,10 @@
 package route
 
-import "net/http"
+import (
+	"net/http"
+
+	gohttp "github.com/likearthian/go-http"
+)
 
 type MiddlewareFunc func(next http.Handler) http.Handler
 
@@ -12,6 +16,11 @@ type Router interface {
 
 	Methods(method ...string) *Route
 
+	// Mount serves handler for pattern and every path below it.
+	Mount(pattern string, handler http.Handler)
+
+	// Subroute creates a router mounted under pattern.
+	Subroute(pattern string) Router
 }
 
 type Routes interface {
@@ -25,4 +34,11 @@ type Route struct {
 	SubRoutes Routes
 	Handlers  map[string]http.Handler
 	Pattern   string
-}
\ No newline at end of file
+
+	// Metadata documents the handlers, keyed by HTTP method.
+	Metadata map[string]*gohttp.RouteMetadata
+
+	mux     *Mux
+	methods []string
+	meta    *gohttp.RouteMetadata
+}
@@ -0,0 +1,312 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	gohttp "github.com/likearthian/go-http"
+)
+
+// versionRoute is an API version served by its own routing tree.
+type versionRoute struct {
+	name         string
+	router       *Router
+	deprecated   bool
+	deprecatedAt time.Time
+	sunset       time.Time
+}
+
+type versioning struct {
+	resolvers      []versionResolver
+	defaultVersion string
+	byPath         bool
+	// headers varying the response, for the Vary header
+	vary []string
+}
+
+// versionResolver extracts the requested version from r. path is the request
+// path with the version removed, or "" when the path is kept as is.
+type versionResolver func(r *http.Request) (version, path string)
+
+type VersionOption func(*versionRoute)
+
+// VersionDeprecated marks the version as deprecated: its responses carry a
+// Deprecation header, holding deprecatedAt when it is not zero, and a Sunset
+// header when sunset is not zero.
+func VersionDeprecated(deprecatedAt, sunset time.Time) VersionOption {
+	return func(v *versionRoute) {
+		v.deprecated = true
+		v.deprecatedAt = deprecatedAt
+		v.sunset = sunset
+	}
+}
+
+// VersionByPath resolves the API version from the first path segment, e.g.
+// /v2/users is served by the routes of version 2 registered as /users. Only
+// a segment of a "v" followed by digits, e.g. v2 or v2.1, names a version.
+func VersionByPath() RouterOption {
+	return func(r *Router) {
+		cfg := r.versioningConfig()
+		cfg.byPath = true
+		cfg.resolvers = append(cfg.resolvers, func(req *http.Request) (string, string) {
+			path := strings.TrimPrefix(req.URL.Path, r.prefix)
+			if !strings.HasPrefix(path, "/v") {
+				return "", ""
+			}
+
+			seg := path[2:]
+			rest := "/"
+			if i := strings.IndexByte(seg, '/'); i >= 0 {
+				seg, rest = seg[:i], seg[i:]
+			}
+			if !isVersionNumber(seg) {
+				return "", ""
+			}
+			return seg, r.prefix + rest
+		})
+	}
+}
+
+// isVersionNumber reports whether s is made of digits and dots, starting
+// with a digit.
+func isVersionNumber(s string) bool {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && s[i] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// VersionByHeader resolves the API version from the value of header, e.g.
+// X-API-Version: 2.
+func VersionByHeader(header string) RouterOption {
+	return func(r *Router) {
+		cfg := r.versioningConfig()
+		cfg.vary = append(cfg.vary, header)
+		cfg.resolvers = append(cfg.resolvers, func(req *http.Request) (string, string) {
+			return strings.TrimPrefix(strings.TrimSpace(req.Header.Get(header)), "v"), ""
+		})
+	}
+}
+
+// VersionByAccept resolves the API version from a vendor media type of the
+// Accept header, e.g. application/vnd.company.v2+json for vendor
+// "vnd.company".
+func VersionByAccept(vendor string) RouterOption {
+	prefix := strings.ToLower(vendor) + ".v"
+	return func(r *Router) {
+		cfg := r.versioningConfig()
+		cfg.vary = append(cfg.vary, gohttp.HeaderAccept)
+		cfg.resolvers = append(cfg.resolvers, func(req *http.Request) (string, string) {
+			for _, accept := range req.Header.Values(gohttp.HeaderAccept) {
+				for _, mediaRange := range strings.Split(accept, ",") {
+					mediaType, _, err := mime.ParseMediaType(mediaRange)
+					if err != nil {
+						continue
+					}
+
+					i := strings.IndexByte(mediaType, '/')
+					subtype := mediaType[i+1:]
+					if !strings.HasPrefix(subtype, prefix) {
+						continue
+					}
+
+					version := subtype[len(prefix):]
+					if i := strings.IndexByte(version, '+'); i >= 0 {
+						version = version[:i]
+					}
+					return version, ""
+				}
+			}
+			return "", ""
+		})
+	}
+}
+
+// DefaultVersion sets the version serving the requests that do not ask for
+// one and match no route of the router itself. Without a default version,
+// they are all served by the routes of the router itself.
+func DefaultVersion(version string) RouterOption {
+	return func(r *Router) {
+		r.versioningConfig().defaultVersion = strings.TrimPrefix(version, "v")
+	}
+}
+
+func (rtr *Router) versioningConfig() *versioning {
+	if rtr.versioning == nil {
+		rtr.versioning = &versioning{}
+	}
+	return rtr.versioning
+}
+
+// Version creates a router serving the routes of an API version. The
+// version a request asks for is resolved by the strategies given to
+// NewRouter, VersionByPath, VersionByHeader and VersionByAccept, tried in
+// that order; a version with a leading "v" is the same as without it.
+//
+// Requests asking for an unknown version through a header are answered with
+// 406 Not Acceptable. The version router inherits the middlewares and CORS
+// config of rtr; options apply to the version router only.
+//
+// Version must be called on the router that serves the requests.
+func (rtr *Router) Version(version string, options ...VersionOption) *Router {
+	router := &Router{
+		router:      httprouter.New(),
+		prefix:      rtr.prefix,
+		hostname:    rtr.hostname,
+		middlewares: []MiddlewareFunc{},
+		routes:      []*Route{},
+		subRouters:  []*Router{},
+		isInit:      false,
+		cors:        rtr.cors,
+		debugLogger: rtr.debugLogger,
+	}
+
+	v := &versionRoute{name: strings.TrimPrefix(version, "v"), router: router}
+	for _, op := range options {
+		op(v)
+	}
+
+	rtr.versions = append(rtr.versions, v)
+
+	return router
+}
+
+func (rtr *Router) initVersions() error {
+	names := map[string]bool{}
+	for _, v := range rtr.versions {
+		if names[v.name] {
+			return fmt.Errorf("version %s registered twice", v.name)
+		}
+		names[v.name] = true
+
+		var middlewares []MiddlewareFunc
+		middlewares = append(middlewares, rtr.middlewares...)
+		middlewares = append(middlewares, v.router.middlewares...)
+
+		v.router.middlewares = middlewares
+		if err := v.router.Build(); err != nil {
+			return fmt.Errorf("version %s: %w", v.name, err)
+		}
+	}
+
+	if rtr.versioning != nil && rtr.versioning.defaultVersion != "" && !names[rtr.versioning.defaultVersion] {
+		return fmt.Errorf("default version %s is not registered", rtr.versioning.defaultVersion)
+	}
+
+	return nil
+}
+
+func (rtr *Router) findVersion(name string) *versionRoute {
+	for _, v := range rtr.versions {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// serveVersion dispatches r to the version it asks for and reports whether
+// it did.
+func (rtr *Router) serveVersion(w http.ResponseWriter, r *http.Request) bool {
+	if len(rtr.versions) == 0 || rtr.versioning == nil {
+		return false
+	}
+
+	for _, h := range rtr.versioning.vary {
+		w.Header().Add(gohttp.HeaderVary, h)
+	}
+
+	var v *versionRoute
+	path := ""
+	for _, resolve := range rtr.versioning.resolvers {
+		name, p := resolve(r)
+		if name == "" {
+			continue
+		}
+
+		if v = rtr.findVersion(name); v != nil {
+			path = p
+			break
+		}
+
+		// a prefix that names no version is an ordinary path
+		if p == "" {
+			http.Error(w, fmt.Sprintf("unsupported API version %q", name), http.StatusNotAcceptable)
+			return true
+		}
+	}
+
+	if v == nil && rtr.versioning.defaultVersion != "" && !rtr.hasRoute(r) {
+		v = rtr.findVersion(rtr.versioning.defaultVersion)
+	}
+	if v == nil {
+		return false
+	}
+
+	if path != "" {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		r = r2
+	}
+
+	if v.deprecated {
+		deprecation := "true"
+		if !v.deprecatedAt.IsZero() {
+			deprecation = "@" + strconv.FormatInt(v.deprecatedAt.Unix(), 10)
+		}
+		w.Header().Set(gohttp.HeaderDeprecation, deprecation)
+		if !v.sunset.IsZero() {
+			w.Header().Set(gohttp.HeaderSunset, v.sunset.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), ContextKeyAPIVersion, v.name))
+	v.router.ServeHTTP(w, r)
+	return true
+}
+
+// hasRoute reports whether the routes of rtr, registered with Methods or at
+// runtime, serve the path of r for its method. Any method matches for an
+// OPTIONS request, which is answered for every route.
+func (rtr *Router) hasRoute(r *http.Request) bool {
+	methods := []string{r.Method}
+	if r.Method == http.MethodOptions {
+		methods = append(methods, http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+			http.MethodPatch, http.MethodDelete, http.MethodConnect, http.MethodTrace)
+	}
+
+	for _, tree := range []*httprouter.Router{rtr.runtimeTree(), rtr.router} {
+		if tree == nil {
+			continue
+		}
+		for _, m := range methods {
+			if h, _, _ := tree.Lookup(m, r.URL.Path); h != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VersionFromContext returns the API version serving the request, as
+// registered with Router.Version but without a leading "v".
+func VersionFromContext(ctx context.Context) string {
+	version, _ := ctx.Value(ContextKeyAPIVersion).(string)
+	return version
+}
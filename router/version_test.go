@@ -0,0 +1,106 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gohttp "github.com/likearthian/go-http"
+	"github.com/tj/assert"
+)
+
+func TestVersioning(t *testing.T) {
+	writeVersion := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, VersionFromContext(r.Context())+" "+GetParamsFromContext(r.Context()).ByName("id"))
+	})
+
+	rtr := NewRouter(
+		VersionByPath(),
+		VersionByHeader("X-API-Version"),
+		VersionByAccept("vnd.company"),
+		DefaultVersion("1"),
+	)
+	rtr.Methods(http.MethodGet).Handler("/health", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	v1 := rtr.Version("v1", VersionDeprecated(time.Time{}, sunset))
+	v1.Methods(http.MethodGet).Handler("/users/:id", writeVersion)
+
+	v2 := rtr.Version("2")
+	v2.Methods(http.MethodGet).Handler("/users/:id", writeVersion)
+	rtr.Methods(http.MethodGet).Handler("/validate", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "validated")
+	}))
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		value  string
+		code   int
+		body   string
+	}{
+		{"path", "/v2/users/7", "", "", http.StatusOK, "2 7"},
+		{"path v1", "/v1/users/7", "", "", http.StatusOK, "1 7"},
+		{"header", "/users/7", "X-API-Version", "2", http.StatusOK, "2 7"},
+		{"accept", "/users/7", gohttp.HeaderAccept, "text/html, application/vnd.company.v2+json;q=0.9", http.StatusOK, "2 7"},
+		{"default", "/users/7", "", "", http.StatusOK, "1 7"},
+		{"path wins", "/v1/users/7", "X-API-Version", "2", http.StatusOK, "1 7"},
+		{"unknown header", "/users/7", "X-API-Version", "3", http.StatusNotAcceptable, ""},
+		{"unknown path", "/v3/users/7", "", "", http.StatusNotFound, ""},
+		{"root route", "/health", "", "", http.StatusOK, "ok"},
+		{"root route starting with v", "/validate", "", "", http.StatusOK, "validated"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, req)
+
+		assert.Equal(t, test.code, rec.Code, test.name)
+		if test.body != "" {
+			assert.Equal(t, test.body, rec.Body.String(), test.name)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/7", nil))
+	assert.Equal(t, "true", rec.Header().Get(gohttp.HeaderDeprecation))
+	assert.Equal(t, "Fri, 01 Jan 2027 00:00:00 GMT", rec.Header().Get(gohttp.HeaderSunset))
+	assert.Equal(t, []string{"X-API-Version", gohttp.HeaderAccept}, rec.Header().Values(gohttp.HeaderVary))
+
+	rec = httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/users/7", nil))
+	assert.Empty(t, rec.Header().Get(gohttp.HeaderDeprecation))
+
+	var paths []string
+	for _, r := range rtr.Routes() {
+		paths = append(paths, r.Version+" "+r.Path)
+	}
+	assert.Equal(t, []string{" /health", " /validate", "1 /v1/users/:id", "2 /v2/users/:id"}, paths)
+}
+
+func TestVersioningWithoutDefault(t *testing.T) {
+	rtr := NewRouter(VersionByHeader("X-API-Version"))
+	rtr.Methods(http.MethodGet).Handler("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "unversioned")
+	}))
+	rtr.Version("2").Methods(http.MethodGet).Handler("/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "v2")
+	}))
+
+	rec := httptest.NewRecorder()
+	rtr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	assert.Equal(t, "unversioned", rec.Body.String())
+
+	bad := NewRouter(DefaultVersion("3"))
+	bad.Version("2")
+	assert.EqualError(t, bad.Build(), "default version 3 is not registered")
+}